@@ -0,0 +1,86 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCopy(t *testing.T) {
+	one := func() Expression { return &IntegerLiteral{Value: 1} }
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+	block := func(exps ...Expression) *BlockStatement {
+		stmts := []Statement{}
+		for _, exp := range exps {
+			stmts = append(stmts, &ExpressionStatement{Expression: exp})
+		}
+		return &BlockStatement{Statements: stmts}
+	}
+
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{Name: ident("f"), Value: &FunctionLiteral{
+				Parameters: []*Identifier{ident("x")},
+				Body:       block(&InfixExpression{Left: ident("x"), Operator: "+", Right: one()}),
+			}},
+			&FunctionStatement{Name: ident("g"), Function: &FunctionLiteral{Body: block()}},
+			&WhileStatement{Condition: &Boolean{Value: true}, Body: &BlockStatement{
+				Statements: []Statement{&BreakStatement{}, &ContinueStatement{}},
+			}},
+			&ForStatement{Value: ident("v"), Iterable: &ArrayLiteral{Elements: []Expression{one()}}, Body: block()},
+			&ReturnStatement{ReturnValue: &IfExpression{
+				Condition:   &LogicalExpression{Left: one(), Operator: "&&", Right: one()},
+				Consequence: block(&PrefixExpression{Operator: "-", Right: one()}),
+				Alternative: block(&AssignExpression{Target: ident("a"), Operator: "=", Value: one()}),
+			}},
+			&ExpressionStatement{Expression: &CallExpression{
+				Function:  ident("h"),
+				Arguments: []Expression{&StringLiteral{Value: "s"}, &FloatLiteral{Value: 1.5}},
+			}},
+			&ExpressionStatement{Expression: &IndexExpression{Left: ident("a"), Index: one()}},
+			&ExpressionStatement{Expression: &MacroLiteral{Parameters: []*Identifier{ident("m")}, Body: block(one())}},
+		},
+	}
+
+	original := program.String()
+	copied := Copy(program)
+	if !reflect.DeepEqual(copied, program) {
+		t.Fatalf("copy not equal. got=%s, want=%s", copied, program)
+	}
+
+	// rewriting the copy must leave the original alone
+	Modify(copied, func(node Node) Node {
+		if integer, ok := node.(*IntegerLiteral); ok {
+			integer.Value = 2
+		}
+		if ident, ok := node.(*Identifier); ok {
+			ident.Value = "renamed"
+		}
+		return node
+	})
+	if reflect.DeepEqual(copied, program) {
+		t.Fatalf("modifying the copy had no effect")
+	}
+
+	if program.String() != original {
+		t.Errorf("original changed. want=%q, got=%q", original, program.String())
+	}
+
+	hash := &HashLiteral{Pairs: map[Expression]Expression{one(): one()}}
+	copiedHash := Copy(hash).(*HashLiteral)
+	for key, val := range copiedHash.Pairs {
+		for origKey, origVal := range hash.Pairs {
+			if key == origKey || val == origVal {
+				t.Errorf("hash pair not copied")
+			}
+		}
+	}
+
+	binding := &Identifier{Unquote: &CallExpression{Function: ident("unquote"), Arguments: []Expression{one()}}}
+	copiedBinding := Copy(binding).(*Identifier)
+	if !reflect.DeepEqual(copiedBinding, binding) {
+		t.Fatalf("copy not equal. got=%s, want=%s", copiedBinding, binding)
+	}
+	if copiedBinding.Unquote == binding.Unquote {
+		t.Errorf("unquote of binding not copied")
+	}
+}
@@ -0,0 +1,171 @@
+package ast
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format prints node as source code, one statement per line with blocks
+// indented by a tab. String is terse and meant for tests; Format keeps braces
+// around blocks and quotes strings, so the output reads like the code it was
+// parsed from.
+func Format(node Node) string {
+	f := &formatter{}
+	if program, ok := node.(*Program); ok {
+		lines := []string{}
+		for _, stmt := range program.Statements {
+			lines = append(lines, f.statement(stmt))
+		}
+		return strings.Join(lines, "\n")
+	}
+	if stmt, ok := node.(Statement); ok {
+		return f.statement(stmt)
+	}
+	if exp, ok := node.(Expression); ok {
+		return f.expression(exp)
+	}
+	return ""
+}
+
+type formatter struct {
+	indent int
+}
+
+func (f *formatter) statement(stmt Statement) string {
+	switch stmt := stmt.(type) {
+	case *LetStatement:
+		return "let " + f.expression(stmt.Name) + " = " + f.bare(stmt.Value) + ";"
+	case *FunctionStatement:
+		if stmt.Function == nil {
+			return "fn " + f.expression(stmt.Name) + "() {}"
+		}
+		return "fn " + f.expression(stmt.Name) + f.params(stmt.Function.Parameters) + " " +
+			f.block(stmt.Function.Body)
+	case *WhileStatement:
+		return "while (" + f.bare(stmt.Condition) + ") " + f.block(stmt.Body)
+	case *ForStatement:
+		vars := f.expression(stmt.Value)
+		if stmt.Key != nil {
+			vars = f.expression(stmt.Key) + ", " + vars
+		}
+		return "for (" + vars + " in " + f.bare(stmt.Iterable) + ") " + f.block(stmt.Body)
+	case *BreakStatement:
+		return "break;"
+	case *ContinueStatement:
+		return "continue;"
+	case *ReturnStatement:
+		return "return " + f.bare(stmt.ReturnValue) + ";"
+	case *ExpressionStatement:
+		if exp, ok := stmt.Expression.(*IfExpression); ok {
+			return f.expression(exp)
+		}
+		return f.bare(stmt.Expression) + ";"
+	case *BlockStatement:
+		return f.block(stmt)
+	case nil:
+		return ""
+	}
+	return stmt.String()
+}
+
+func (f *formatter) block(block *BlockStatement) string {
+	if block == nil || len(block.Statements) == 0 {
+		return "{}"
+	}
+
+	var out strings.Builder
+	out.WriteString("{\n")
+	f.indent++
+	for _, stmt := range block.Statements {
+		out.WriteString(strings.Repeat("\t", f.indent))
+		out.WriteString(f.statement(stmt))
+		out.WriteString("\n")
+	}
+	f.indent--
+	out.WriteString(strings.Repeat("\t", f.indent))
+	out.WriteString("}")
+	return out.String()
+}
+
+func (f *formatter) expression(exp Expression) string {
+	switch exp := exp.(type) {
+	case *StringLiteral:
+		return strconv.Quote(exp.Value)
+	case *PrefixExpression:
+		return "(" + exp.Operator + f.expression(exp.Right) + ")"
+	case *InfixExpression:
+		return "(" + f.expression(exp.Left) + " " + exp.Operator + " " + f.expression(exp.Right) + ")"
+	case *LogicalExpression:
+		return "(" + f.expression(exp.Left) + " " + exp.Operator + " " + f.expression(exp.Right) + ")"
+	case *AssignExpression:
+		return "(" + f.expression(exp.Target) + " " + exp.Operator + " " + f.expression(exp.Value) + ")"
+	case *IfExpression:
+		out := "if (" + f.bare(exp.Condition) + ") " + f.block(exp.Consequence)
+		if exp.Alternative != nil {
+			out += " else " + f.alternative(exp.Alternative)
+		}
+		return out
+	case *FunctionLiteral:
+		return "fn" + f.params(exp.Parameters) + " " + f.block(exp.Body)
+	case *MacroLiteral:
+		return "macro" + f.params(exp.Parameters) + " " + f.block(exp.Body)
+	case *CallExpression:
+		return f.expression(exp.Function) + "(" + f.list(exp.Arguments) + ")"
+	case *ArrayLiteral:
+		return "[" + f.list(exp.Elements) + "]"
+	case *IndexExpression:
+		return f.expression(exp.Left) + "[" + f.bare(exp.Index) + "]"
+	case *HashLiteral:
+		// the pairs are kept in a map, sort them so the output is stable
+		pairs := []string{}
+		for key, value := range exp.Pairs {
+			pairs = append(pairs, f.bare(key)+": "+f.bare(value))
+		}
+		sort.Strings(pairs)
+		return "{" + strings.Join(pairs, ", ") + "}"
+	case nil:
+		return ""
+	}
+	return exp.String()
+}
+
+// bare prints exp without the parentheses around an operator, for places
+// where it stands on its own, like a condition or an argument
+func (f *formatter) bare(exp Expression) string {
+	s := f.expression(exp)
+	switch exp.(type) {
+	case *PrefixExpression, *InfixExpression, *LogicalExpression, *AssignExpression:
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// alternative prints an else branch, the block the parser wraps around an
+// else if is left out again
+func (f *formatter) alternative(block *BlockStatement) string {
+	if len(block.Statements) == 1 {
+		if stmt, ok := block.Statements[0].(*ExpressionStatement); ok {
+			if ifExp, ok := stmt.Expression.(*IfExpression); ok {
+				return f.expression(ifExp)
+			}
+		}
+	}
+	return f.block(block)
+}
+
+func (f *formatter) params(params []*Identifier) string {
+	names := []string{}
+	for _, param := range params {
+		names = append(names, f.expression(param))
+	}
+	return "(" + strings.Join(names, ", ") + ")"
+}
+
+func (f *formatter) list(exps []Expression) string {
+	items := []string{}
+	for _, exp := range exps {
+		items = append(items, f.bare(exp))
+	}
+	return strings.Join(items, ", ")
+}
@@ -0,0 +1,59 @@
+package ast
+
+import (
+	"testing"
+
+	"github.com/iZarrios/monkey-lang/token"
+)
+
+func TestFormat(t *testing.T) {
+	str := func(s string) *StringLiteral {
+		return &StringLiteral{Token: token.Token{Literal: s}, Value: s}
+	}
+	ident := func(name string) *Identifier {
+		return &Identifier{Token: token.Token{Literal: name}, Value: name}
+	}
+	integer := func(n string) *IntegerLiteral {
+		return &IntegerLiteral{Token: token.Token{Literal: n}}
+	}
+	call := func(fn string, args ...Expression) *CallExpression {
+		return &CallExpression{Function: ident(fn), Arguments: args}
+	}
+
+	program := &Program{Statements: []Statement{
+		&LetStatement{Name: ident("s"), Value: str("a, \"b\"\n")},
+		&ExpressionStatement{Expression: &IfExpression{
+			Condition: &InfixExpression{Left: ident("x"), Operator: ">", Right: integer("1")},
+			Consequence: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &AssignExpression{
+					Target: ident("x"), Operator: "=",
+					Value: &InfixExpression{Left: ident("x"), Operator: "*", Right: &PrefixExpression{Operator: "-", Right: integer("2")}},
+				}},
+			}},
+			Alternative: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: &IfExpression{
+					Condition:   &Boolean{Token: token.Token{Literal: "true"}, Value: true},
+					Consequence: &BlockStatement{},
+				}},
+			}},
+		}},
+		&ReturnStatement{ReturnValue: &FunctionLiteral{
+			Parameters: []*Identifier{ident("a")},
+			Body: &BlockStatement{Statements: []Statement{
+				&ExpressionStatement{Expression: call("puts", &ArrayLiteral{Elements: []Expression{str("x"), ident("a")}})},
+			}},
+		}},
+	}}
+
+	expected := `let s = "a, \"b\"\n";
+if (x > 1) {
+	x = (x * (-2));
+} else if (true) {}
+return fn(a) {
+	puts(["x", a]);
+};`
+
+	if Format(program) != expected {
+		t.Errorf("wrong output.\nwant=\n%s\ngot=\n%s", expected, Format(program))
+	}
+}
@@ -0,0 +1,113 @@
+package ast
+
+// Inspect traverses the tree rooted at node depth-first, calling f for every
+// node before its children. Children are skipped when f returns false. Unlike
+// Modify, Inspect visits the identifiers that are only being bound, like the
+// name of a let or the parameters of a function.
+func Inspect(node Node, f func(Node) bool) {
+	if node == nil || !f(node) {
+		return
+	}
+
+	switch node := node.(type) {
+
+	case *Program:
+		for _, statement := range node.Statements {
+			inspectStatement(statement, f)
+		}
+
+	case *LetStatement:
+		inspectIdentifier(node.Name, f)
+		inspectExpression(node.Value, f)
+	case *FunctionStatement:
+		inspectIdentifier(node.Name, f)
+		if node.Function != nil {
+			Inspect(node.Function, f)
+		}
+	case *WhileStatement:
+		inspectExpression(node.Condition, f)
+		inspectBlock(node.Body, f)
+	case *ForStatement:
+		inspectIdentifier(node.Key, f)
+		inspectIdentifier(node.Value, f)
+		inspectExpression(node.Iterable, f)
+		inspectBlock(node.Body, f)
+	case *ReturnStatement:
+		inspectExpression(node.ReturnValue, f)
+	case *ExpressionStatement:
+		inspectExpression(node.Expression, f)
+	case *BlockStatement:
+		for _, statement := range node.Statements {
+			inspectStatement(statement, f)
+		}
+
+	case *PrefixExpression:
+		inspectExpression(node.Right, f)
+	case *InfixExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Right, f)
+	case *LogicalExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Right, f)
+	case *AssignExpression:
+		inspectExpression(node.Target, f)
+		inspectExpression(node.Value, f)
+	case *IfExpression:
+		inspectExpression(node.Condition, f)
+		inspectBlock(node.Consequence, f)
+		inspectBlock(node.Alternative, f)
+	case *FunctionLiteral:
+		for _, param := range node.Parameters {
+			inspectIdentifier(param, f)
+		}
+		inspectBlock(node.Body, f)
+	case *MacroLiteral:
+		for _, param := range node.Parameters {
+			inspectIdentifier(param, f)
+		}
+		inspectBlock(node.Body, f)
+	case *CallExpression:
+		inspectExpression(node.Function, f)
+		for _, arg := range node.Arguments {
+			inspectExpression(arg, f)
+		}
+	case *ArrayLiteral:
+		for _, el := range node.Elements {
+			inspectExpression(el, f)
+		}
+	case *IndexExpression:
+		inspectExpression(node.Left, f)
+		inspectExpression(node.Index, f)
+	case *HashLiteral:
+		for key, val := range node.Pairs {
+			inspectExpression(key, f)
+			inspectExpression(val, f)
+		}
+	}
+}
+
+// the helpers keep typed nil pointers from reaching Inspect as non-nil Nodes
+
+func inspectStatement(stmt Statement, f func(Node) bool) {
+	if stmt != nil {
+		Inspect(stmt, f)
+	}
+}
+
+func inspectExpression(exp Expression, f func(Node) bool) {
+	if exp != nil {
+		Inspect(exp, f)
+	}
+}
+
+func inspectIdentifier(ident *Identifier, f func(Node) bool) {
+	if ident != nil {
+		Inspect(ident, f)
+	}
+}
+
+func inspectBlock(block *BlockStatement, f func(Node) bool) {
+	if block != nil {
+		Inspect(block, f)
+	}
+}
@@ -0,0 +1,43 @@
+package ast
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInspect(t *testing.T) {
+	ident := func(name string) *Identifier { return &Identifier{Value: name} }
+
+	program := &Program{
+		Statements: []Statement{
+			&LetStatement{Name: ident("a"), Value: &FunctionLiteral{
+				Parameters: []*Identifier{ident("b")},
+				Body: &BlockStatement{Statements: []Statement{
+					&ExpressionStatement{Expression: &CallExpression{
+						Function:  ident("skip"),
+						Arguments: []Expression{ident("hidden")},
+					}},
+					&ForStatement{Key: ident("c"), Value: ident("d"), Iterable: ident("e"),
+						Body: &BlockStatement{}},
+				}},
+			}},
+			&ExpressionStatement{Expression: &InfixExpression{Left: ident("f"), Right: ident("g")}},
+		},
+	}
+
+	visited := []string{}
+	Inspect(program, func(node Node) bool {
+		if call, ok := node.(*CallExpression); ok {
+			return call.Function.String() != "skip"
+		}
+		if ident, ok := node.(*Identifier); ok {
+			visited = append(visited, ident.Value)
+		}
+		return true
+	})
+
+	expected := []string{"a", "b", "c", "d", "e", "f", "g"}
+	if !reflect.DeepEqual(visited, expected) {
+		t.Errorf("wrong identifiers visited. want=%v, got=%v", expected, visited)
+	}
+}
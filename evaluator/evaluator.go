@@ -1,11 +1,39 @@
 package evaluator
 
 import (
+	"math"
+	"strings"
+
 	"github.com/iZarrios/monkey-lang/ast"
 	"github.com/iZarrios/monkey-lang/object"
+	"github.com/iZarrios/monkey-lang/token"
 )
 
-func Eval(node ast.Node, env *object.Environment) object.Object {
+// Eval evaluates node in env. A bad program can't take down the host: should
+// anything in the evaluator panic, the panic is turned into an error object,
+// and calls nested deeper than maxCallDepth fail before Go runs out of stack.
+func Eval(node ast.Node, env *object.Environment) (result object.Object) {
+	defer func() {
+		if r := recover(); r != nil {
+			result = newError("internal error: %v", r)
+		}
+	}()
+
+	return eval(node, env)
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
+	result := evalNode(node, env)
+
+	// The innermost node an error comes out of is where it was raised
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && node != nil {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+func evalNode(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 
 	// Statements
@@ -13,55 +41,90 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		return evalProgram(node, env)
 
 	case *ast.BlockStatement:
-		return evalBlockStatement(node, env)
+		// bindings made inside a block don't outlive it
+		return evalBlockStatement(node, object.NewEnclosedEnvironment(env))
 
 	case *ast.ExpressionStatement:
-		return Eval(node.Expression, env)
+		return eval(node.Expression, env)
 
 	case *ast.ReturnStatement:
-		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		val := eval(node.ReturnValue, env)
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
 
 	case *ast.LetStatement:
-		val := Eval(node.Value, env)
-		if isError(val) {
+		if err := checkBindings(node.Name); err != nil {
+			return err
+		}
+		val := eval(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
 		env.Set(node.Name.Value, val)
 
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		if err := checkBindings(node.Key, node.Value); err != nil {
+			return err
+		}
+		return evalForStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
+
+	case *ast.FunctionStatement:
+		// already bound by hoistFunctions when the enclosing block was entered
+		return nil
+
 	// Expressions
 	case *ast.IntegerLiteral:
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
+	case *ast.NullLiteral:
+		return NULL
+
 	case *ast.StringLiteral:
 		return &object.String{Value: node.Value}
 
 	case *ast.PrefixExpression:
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
 
-		right := Eval(node.Right, env)
-		if isError(right) {
+		right := eval(node.Right, env)
+		if isAbrupt(right) {
 			return right
 		}
 
 		return evalInfixExpression(node.Operator, left, right)
 
+	case *ast.LogicalExpression:
+		return evalLogicalExpression(node, env)
+
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+
 	case *ast.IfExpression:
 		return evalIfExpression(node, env)
 
@@ -71,37 +134,57 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
-		return &object.Function{Parameters: params, Env: env, Body: body}
+		return &object.Function{Name: node.Name, Parameters: params, Env: env, Body: body}
+
+	case *ast.MacroLiteral:
+		// DefineMacros takes the ones at the top level out before evaluation
+		return newError("macros can only be defined with a top-level let")
 
 	case *ast.CallExpression:
 		if node.Function.TokenLiteral() == "quote" {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(node.Arguments))
+			}
 			return quote(node.Arguments[0], env)
 		}
-		function := Eval(node.Function, env)
-		if isError(function) {
+		if isMacroexpandCall(node) {
+			if len(node.Arguments) != 1 {
+				return newError("wrong number of arguments. got=%d, want=1",
+					len(node.Arguments))
+			}
+			return macroexpand(node, env)
+		}
+		function := eval(node.Function, env)
+		if isAbrupt(function) {
 			return function
 		}
 
 		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 
-		return applyFunction(function, args)
+		result := applyFunction(function, args, node.Function.Pos())
+		if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() {
+			// point at the callee rather than at the '('
+			err.Pos = node.Function.Pos()
+		}
+		return result
 	case *ast.ArrayLiteral:
 		els := evalExpressions(node.Elements, env)
-		if len(els) == 1 && isError(els[0]) {
+		if len(els) == 1 && isAbrupt(els[0]) {
 			return els[0]
 		}
 
 		return &object.Array{Elements: els}
 	case *ast.IndexExpression:
-		left := Eval(node.Left, env)
-		if isError(left) {
+		left := eval(node.Left, env)
+		if isAbrupt(left) {
 			return left
 		}
-		index := Eval(node.Index, env)
-		if isError(index) {
+		index := eval(node.Index, env)
+		if isAbrupt(index) {
 			return index
 		}
 		return evalIndexExpression(left, index)
@@ -118,6 +201,8 @@ func evalPrefixExpression(op string, right object.Object) object.Object {
 		return evalBangOpExpression(right)
 	case "-":
 		return evalMinusOpExpression(right)
+	case "~":
+		return evalTildeOpExpression(right)
 	default:
 		return newError("unknown operator: %s%s", op, right.Type())
 	}
@@ -137,20 +222,31 @@ func evalBangOpExpression(right object.Object) object.Object {
 }
 
 func evalMinusOpExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		return &object.Integer{Value: -right.Value}
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
+}
 
-	//FIXME: instead of allocating a new object, we just return the one given to us, as we are sure of the type
-	value := right.(*object.Integer).Value
-
-	return &object.Integer{Value: -value}
+func evalTildeOpExpression(right object.Object) object.Object {
+	integer, ok := right.(*object.Integer)
+	if !ok {
+		return newError("unknown operator: ~%s", right.Type())
+	}
+	return &object.Integer{Value: ^integer.Value}
 }
 
 func evalInfixExpression(op string, left, right object.Object) object.Object {
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(op, left, right)
+	case isNumber(left) && isNumber(right):
+		// at least one of them is a float, the other one gets promoted
+		return evalFloatInfixExpression(op, left, right)
 	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
 		return evalStringInfixExpression(op, left, right)
 	case op == "==":
@@ -175,11 +271,81 @@ func evalIntegerInfixExpression(op string, left, right object.Object) object.Obj
 	case "*":
 		return &object.Integer{Value: leftVal * rightVal}
 	case "/":
+		if rightVal == 0 {
+			return newError("division by zero")
+		}
 		return &object.Integer{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("modulo by zero")
+		}
+		return &object.Integer{Value: leftVal % rightVal}
+	case "**":
+		if rightVal < 0 {
+			return newError("negative exponent: %d", rightVal)
+		}
+		return &object.Integer{Value: intPow(leftVal, rightVal)}
+	case "&":
+		return &object.Integer{Value: leftVal & rightVal}
+	case "|":
+		return &object.Integer{Value: leftVal | rightVal}
+	case "^":
+		return &object.Integer{Value: leftVal ^ rightVal}
+	case "<<":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		return &object.Integer{Value: leftVal << rightVal}
+	case ">>":
+		if rightVal < 0 {
+			return newError("negative shift count: %d", rightVal)
+		}
+		return &object.Integer{Value: leftVal >> rightVal}
 	case "<":
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
+	case "==":
+		return nativeBoolToBooleanObject(leftVal == rightVal)
+	case "!=":
+		return nativeBoolToBooleanObject(leftVal != rightVal)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), op, right.Type())
+	}
+}
+
+func evalFloatInfixExpression(op string, left, right object.Object) object.Object {
+	leftVal := toFloat(left)
+	rightVal := toFloat(right)
+
+	switch op {
+	case "+":
+		return &object.Float{Value: leftVal + rightVal}
+	case "-":
+		return &object.Float{Value: leftVal - rightVal}
+	case "*":
+		return &object.Float{Value: leftVal * rightVal}
+	case "/":
+		return &object.Float{Value: leftVal / rightVal}
+	case "%":
+		if rightVal == 0 {
+			return newError("modulo by zero")
+		}
+		return &object.Float{Value: math.Mod(leftVal, rightVal)}
+	case "**":
+		return &object.Float{Value: math.Pow(leftVal, rightVal)}
+	case "<":
+		return nativeBoolToBooleanObject(leftVal < rightVal)
+	case ">":
+		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -206,6 +372,10 @@ func evalStringInfixExpression(op string, left, right object.Object) object.Obje
 		return nativeBoolToBooleanObject(leftVal < rightVal)
 	case ">":
 		return nativeBoolToBooleanObject(leftVal > rightVal)
+	case "<=":
+		return nativeBoolToBooleanObject(leftVal <= rightVal)
+	case ">=":
+		return nativeBoolToBooleanObject(leftVal >= rightVal)
 	case "==":
 		return nativeBoolToBooleanObject(leftVal == rightVal)
 	case "!=":
@@ -228,50 +398,299 @@ func isTruthy(obj object.Object) bool {
 	}
 }
 
+// evalAssignExpression evaluates to the value that was stored. A compound
+// operator reads the target before the right-hand side is evaluated.
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	op := strings.TrimSuffix(node.Operator, "=")
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		var current object.Object
+		if op != "" {
+			current = evalIdentifier(target, env)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if op != "" {
+			val = evalInfixExpression(op, current, val)
+			if isError(val) {
+				return val
+			}
+		}
+
+		if !env.Assign(target.Value, val) {
+			return newError("assignment to undeclared identifier: %s", target.Value)
+		}
+		return val
+
+	case *ast.IndexExpression:
+		left := eval(target.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := eval(target.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+
+		var current object.Object
+		if op != "" {
+			current = evalIndexExpression(left, index)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if op != "" {
+			val = evalInfixExpression(op, current, val)
+			if isError(val) {
+				return val
+			}
+		}
+
+		return evalIndexAssignment(left, index, val)
+
+	default:
+		return newError("cannot assign to %s", node.Target)
+	}
+}
+
+// evalIndexAssignment updates arrays and hashes in place, every value that
+// refers to them sees the change
+func evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		idx, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+		if idx.Value < 0 || idx.Value >= int64(len(left.Elements)) {
+			return newError("index out of range: %d", idx.Value)
+		}
+		left.Elements[idx.Value] = val
+		return val
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+		left.Pairs[key.HashKey()] = object.HashPair{Key: index, Value: val}
+		return val
+
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
+// evalLogicalExpression short-circuits: the right operand is only evaluated
+// when the left one doesn't already decide the result
+func evalLogicalExpression(le *ast.LogicalExpression, env *object.Environment) object.Object {
+	left := eval(le.Left, env)
+	if isError(left) {
+		return left
+	}
+
+	switch le.Operator {
+	case "&&":
+		if !isTruthy(left) {
+			return FALSE
+		}
+	case "||":
+		if isTruthy(left) {
+			return TRUE
+		}
+	default:
+		return newError("unknown operator: %s %s", le.Operator, left.Type())
+	}
+
+	right := eval(le.Right, env)
+	if isError(right) {
+		return right
+	}
+	return nativeBoolToBooleanObject(isTruthy(right))
+}
+
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
-	condition := Eval(ie.Condition, env)
+	condition := eval(ie.Condition, env)
 	if isError(condition) {
 		return condition
 	}
 
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return eval(ie.Consequence, env)
 	} else if ie.Alternative != nil {
 		// if Else branch exists
-		return Eval(ie.Alternative, env)
+		return eval(ie.Alternative, env)
 	} else {
 		return NULL
 	}
 }
 
 func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	hoistFunctions(program.Statements, env)
+
 	var result object.Object
 	for _, statement := range program.Statements {
-		result = Eval(statement, env)
+		result = eval(statement, env)
 		switch result := result.(type) {
 		case *object.ReturnValue:
 			return result.Value
 		case *object.Error:
 			return result
+		case *object.Break, *object.Continue:
+			return loopControlError(result)
 		}
 	}
 	return result
 }
 
+// evalWhileStatement loops in Go rather than recursing, so a long running loop
+// doesn't grow the stack
+func evalWhileStatement(ws *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := eval(ws.Condition, env)
+		if isError(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		result := eval(ws.Body, env)
+		switch result.Type() {
+		case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+			return result
+		case object.BREAK_OBJ:
+			return nil
+		}
+	}
+}
+
+// evalForStatement runs the body in a new environment for every element, so a
+// closure created in the body keeps the element it was created for
+func evalForStatement(fs *ast.ForStatement, env *object.Environment) object.Object {
+	iterable := eval(fs.Iterable, env)
+	if isError(iterable) {
+		return iterable
+	}
+
+	// a single name iterates the keys of a hash, and the elements of anything else
+	_, isHash := iterable.(*object.Hash)
+
+	var result object.Object
+	err := iterate(iterable, func(key, value object.Object) bool {
+		loopEnv := object.NewEnclosedEnvironment(env)
+		if fs.Key != nil {
+			loopEnv.Set(fs.Key.Value, key)
+			loopEnv.Set(fs.Value.Value, value)
+		} else if isHash {
+			loopEnv.Set(fs.Value.Value, key)
+		} else {
+			loopEnv.Set(fs.Value.Value, value)
+		}
+
+		evaluated := evalBlockStatement(fs.Body, loopEnv)
+		switch evaluated.Type() {
+		case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+			result = evaluated
+			return false
+		case object.BREAK_OBJ:
+			return false
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// iterate calls fn with every key/value pair of obj until fn returns false.
+// Arrays and strings are keyed by index, ranges by how many values came
+// before, hashes by their keys in sorted order.
+func iterate(obj object.Object, fn func(key, value object.Object) bool) *object.Error {
+	switch obj := obj.(type) {
+	case *object.Array:
+		for i, el := range obj.Elements {
+			if !fn(&object.Integer{Value: int64(i)}, el) {
+				break
+			}
+		}
+	case *object.String:
+		i := 0
+		for _, ch := range obj.Value {
+			if !fn(&object.Integer{Value: int64(i)}, &object.String{Value: string(ch)}) {
+				break
+			}
+			i++
+		}
+	case *object.Hash:
+		for _, pair := range obj.SortedPairs() {
+			if !fn(pair.Key, pair.Value) {
+				break
+			}
+		}
+	case *object.Range:
+		for i := int64(0); i < rangeLen(obj); i++ {
+			n := obj.Start + i*obj.Step
+			if !fn(&object.Integer{Value: i}, &object.Integer{Value: n}) {
+				break
+			}
+		}
+	default:
+		return newError("cannot iterate over %s", obj.Type())
+	}
+	return nil
+}
+
 func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) object.Object {
+	hoistFunctions(block.Statements, env)
+
 	var result object.Object
 	for _, statement := range block.Statements {
-		result = Eval(statement, env)
+		result = eval(statement, env)
 		if result != nil {
-			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			switch result.Type() {
+			case object.RETURN_VALUE_OBJ, object.ERROR_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
 				return result
 			}
 		}
 	}
+	// A block is an expression, so an empty one or one ending in a let still
+	// has to produce a value
+	if result == nil {
+		return NULL
+	}
 	return result
 }
 
+// hoistFunctions binds every function declared directly in statements before
+// any of them run, so declarations can call each other regardless of order
+func hoistFunctions(statements []ast.Statement, env *object.Environment) {
+	for _, statement := range statements {
+		if fs, ok := statement.(*ast.FunctionStatement); ok {
+			fn := fs.Function
+			env.Set(fs.Name.Value, &object.Function{
+				Name:       fs.Name.Value,
+				Parameters: fn.Parameters,
+				Env:        env,
+				Body:       fn.Body,
+			})
+		}
+	}
+}
+
 func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
 
 	if val, ok := env.Get(node.Value); ok {
@@ -284,6 +703,8 @@ func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object
 	return newError("identifier not found: " + node.Value)
 }
 
+// evalExpressions stops at the first error, break or continue and returns it
+// on its own
 func evalExpressions(
 	exps []ast.Expression,
 	env *object.Environment,
@@ -291,8 +712,8 @@ func evalExpressions(
 	var result []object.Object
 
 	for _, e := range exps {
-		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		evaluated := eval(e, env)
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 		result = append(result, evaluated)
@@ -301,11 +722,33 @@ func evalExpressions(
 	return result
 }
 
-func applyFunction(fn object.Object, args []object.Object) object.Object {
+// applyFunction calls fn from the call site at pos. Errors coming out of the
+// body get a frame for this call appended to their trace.
+func applyFunction(fn object.Object, args []object.Object, pos token.Position) object.Object {
 	switch fn := fn.(type) {
 	case *object.Function:
+		if len(args) != len(fn.Parameters) {
+			return newError("wrong number of arguments. got=%d, want=%d",
+				len(args), len(fn.Parameters))
+		}
+		if err := checkBindings(fn.Parameters...); err != nil {
+			return err
+		}
+		if err := enterCall(); err != nil {
+			return err
+		}
+		defer leaveCall()
+
 		extendedEnv := extendFunctionEnv(fn, args)
-		evaluated := Eval(fn.Body, extendedEnv)
+		// the body shares its scope with the parameters
+		evaluated := evalBlockStatement(fn.Body, extendedEnv)
+		switch evaluated.(type) {
+		case *object.Break, *object.Continue:
+			evaluated = loopControlError(evaluated)
+		}
+		if err, ok := evaluated.(*object.Error); ok {
+			err.Trace = append(err.Trace, object.Frame{Function: functionName(fn), Pos: pos})
+		}
 		return unwrapReturnValue(evaluated)
 
 	case *object.Builtin:
@@ -341,6 +784,8 @@ func evalIndexExpression(left, index object.Object) object.Object {
 	switch {
 	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
 		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.STRING_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalStringIndexExpression(left, index)
 	case left.Type() == object.HASH_OBJ:
 		return evalHashIndexExpression(left, index)
 	default:
@@ -358,11 +803,22 @@ func evalArrayIndexExpression(array, index object.Object) object.Object {
 	return arrayObject.Elements[idx]
 }
 
+// Strings are indexed by character, not by byte
+func evalStringIndexExpression(str, index object.Object) object.Object {
+	chars := []rune(str.(*object.String).Value)
+	idx := index.(*object.Integer).Value
+	max := int64(len(chars) - 1)
+	if idx < 0 || idx > max {
+		return NULL
+	}
+	return &object.String{Value: string(chars[idx])}
+}
+
 func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
 	pairs := make(map[object.HashKey]object.HashPair)
 	for keyNode, valueNode := range node.Pairs {
-		key := Eval(keyNode, env)
-		if isError(key) {
+		key := eval(keyNode, env)
+		if isAbrupt(key) {
 			return key
 		}
 		hashKey, ok := key.(object.Hashable)
@@ -370,8 +826,8 @@ func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Obje
 		if !ok {
 			return newError("unusable as hash key: %s", key.Type())
 		}
-		value := Eval(valueNode, env)
-		if isError(value) {
+		value := eval(valueNode, env)
+		if isAbrupt(value) {
 			return value
 		}
 		hashed := hashKey.HashKey()
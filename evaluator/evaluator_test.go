@@ -1,11 +1,15 @@
 package evaluator
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 
+	"github.com/iZarrios/monkey-lang/ast"
 	"github.com/iZarrios/monkey-lang/lexer"
 	"github.com/iZarrios/monkey-lang/object"
 	"github.com/iZarrios/monkey-lang/parser"
+	"github.com/iZarrios/monkey-lang/token"
 )
 
 func testEval(input string) object.Object {
@@ -37,6 +41,27 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"0xFF", 255},
+		{"0o755", 493},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0x_FF + 0b1", 256},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"2 ** 10", 1024},
+		{"2 ** 3 ** 2", 512},
+		{"-2 ** 2", -4},
+		{"3 ** 0", 1},
+		{"0b1100 & 0b1010", 8},
+		{"0b1100 | 0b1010", 14},
+		{"0b1100 ^ 0b1010", 6},
+		{"~0", -1},
+		{"~5", -6},
+		{"1 << 10", 1024},
+		{"1024 >> 3", 128},
+		{"-16 >> 2", -4},
+		{"1 << 64", 0},
+		{"0xFF & 1 << 4 | 1", 17},
 	}
 
 	for _, tt := range tests {
@@ -45,6 +70,87 @@ func TestEvalIntegerExpression(t *testing.T) {
 	}
 }
 
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.5", 3.5},
+		{".5", 0.5},
+		{"-2.5", -2.5},
+		{"1.5 + 1.5", 3},
+		{"1 + 0.5", 1.5},
+		{"0.5 + 1", 1.5},
+		{"10 * 0.25", 2.5},
+		{"1 / 4.0", 0.25},
+		{"7 / 2 * 1.0", 3},
+		{"2e3 - 1", 1999},
+		{"-(1.5 * 2)", -3},
+		{"7.5 % 2", 1.5},
+		{"2.0 ** 3", 8},
+		{"4 ** 0.5", 2},
+		{"2 ** -1.0", 0.5},
+		{"float(3)", 3},
+		{`float("2.5")`, 2.5},
+		{"float(1.25)", 1.25},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testFloatObject(t, evaluated, tt.expected)
+	}
+}
+
+func testFloatObject(t *testing.T, obj object.Object, expected float64) bool {
+	result, ok := obj.(*object.Float)
+	if !ok {
+		t.Errorf("object is not Float. got=%T (%+v)", obj, obj)
+		return false
+	}
+	if result.Value != expected {
+		t.Errorf("object has wrong value. got=%g, want=%g",
+			result.Value, expected)
+		return false
+	}
+	return true
+}
+
+func TestFloatConversions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"int(3.99)", 3},
+		{"int(-3.99)", -3},
+		{"int(7)", 7},
+		{`int("42")`, 42},
+		{`int("0x1F")`, 31},
+		{`int("4.5")`, `cannot convert "4.5" to INTEGER`},
+		{"int(1e300)", "cannot convert 1e+300 to INTEGER"},
+		{`float("abc")`, `cannot convert "abc" to FLOAT`},
+		{"float(true)", "argument to `float` not supported, got BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("object is not Error. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
 	result, ok := obj.(*object.Integer)
 	if !ok {
@@ -83,6 +189,21 @@ func TestEvalBooleanExpression(t *testing.T) {
 		{"(1 < 2) == false", false},
 		{"(1 > 2) == true", false},
 		{"(1 > 2) == false", true},
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"1.5 <= 1.5", true},
+		{"2 >= 2.5", false},
+		{`"a" <= "b"`, true},
+		{`"b" <= "b"`, true},
+		{`"a" >= "b"`, false},
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"0.1 + 0.2 != 0.3", true},
+		{"2.5 == 2.5", true},
 	}
 
 	for _, tt := range tests {
@@ -123,6 +244,33 @@ func TestBangOperator(t *testing.T) {
 	}
 }
 
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"true && true", true},
+		{"true && false", false},
+		{"false && true", false},
+		{"false || true", true},
+		{"false || false", false},
+		{"true || false", true},
+		{"1 && 0", true},
+		{"1 < 2 && 2 < 3", true},
+		{"1 > 2 || 2 > 3", false},
+		{"if (false) { 1 } || true", true},
+		// the right operand is never evaluated
+		{"false && undefinedVariable", false},
+		{"true || undefinedVariable", true},
+		{"let calls = fn() { boom() }; false && calls()", false},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		testBooleanObject(t, evaluated, tt.expected)
+	}
+}
+
 func TestIfElseExpressions(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -136,6 +284,20 @@ func TestIfElseExpressions(t *testing.T) {
 		{"if (1 > 2) { 10 } else { 20 }", 20},
 		{"if (1 < 2) { 10 } else { 20 }", 10},
 		{"if ((1000 / 2) + 250 * 2 == 1000) { 9999 }", 9999},
+		{"if (1 > 2) { 10 } else if (2 > 1) { 20 } else { 30 }", 20},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 } else { 30 }", 30},
+		{"if (1 > 2) { 10 } else if (2 > 3) { 20 }", nil},
+		{"if (null) { 10 } else { 20 }", 20},
+		{"if (true) { null }", nil},
+		{`
+let grade = fn(score) {
+	if (score >= 90) { 4 }
+	else if (score >= 80) { 3 }
+	else if (score >= 70) { 2 }
+	else if (score >= 60) { 1 }
+	else { 0 }
+};
+grade(95) * 10000 + grade(85) * 1000 + grade(75) * 100 + grade(65) * 10 + grade(5)`, 43210},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -233,6 +395,62 @@ return 1;
 			`{"name": "Monkey"}[fn(x) { x }];`,
 			"unusable as hash key: FUNCTION",
 		},
+		{
+			"5 % 0",
+			"modulo by zero",
+		},
+		{
+			"5.5 % 0",
+			"modulo by zero",
+		},
+		{
+			"2 ** -1",
+			"negative exponent: -1",
+		},
+		{
+			"1 << -1",
+			"negative shift count: -1",
+		},
+		{
+			"1 >> -2",
+			"negative shift count: -2",
+		},
+		{
+			"~1.5",
+			"unknown operator: ~FLOAT",
+		},
+		{
+			"1.5 & 1",
+			"unknown operator: FLOAT & INTEGER",
+		},
+		{
+			"true && undefinedVariable",
+			"identifier not found: undefinedVariable",
+		},
+		{
+			"1.5 + true",
+			"type mismatch: FLOAT + BOOLEAN",
+		},
+		{
+			`2.5 + "x"`,
+			"type mismatch: FLOAT + STRING",
+		},
+		{
+			"5 / 0",
+			"division by zero",
+		},
+		{
+			"let f = fn(a, b) { a }; f(1)",
+			"wrong number of arguments. got=1, want=2",
+		},
+		{
+			"fn() { 1 }(1, 2)",
+			"wrong number of arguments. got=2, want=0",
+		},
+		{
+			"quote()",
+			"wrong number of arguments. got=0, want=1",
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -344,6 +562,8 @@ func TestBuiltinFunctions(t *testing.T) {
 		{`len("")`, 0},
 		{`len("four")`, 4},
 		{`len("hello world")`, 11},
+		{`len("héllo")`, 5},
+		{`len("日本語")`, 3},
 		{`len(1)`, "argument to `len` not supported, got INTEGER"},
 		{`len("one", "two")`, "wrong number of arguments. got=2, want=1"},
 	}
@@ -510,6 +730,26 @@ func TestHashIndexExpressions(t *testing.T) {
 			`{false: 5}[false]`,
 			5,
 		},
+		{
+			`{1: 5}[1.0]`,
+			5,
+		},
+		{
+			`{2.0: 5}[2]`,
+			5,
+		},
+		{
+			`{0.0: 5}[-0.0]`,
+			5,
+		},
+		{
+			`{1.5: 5}[1.5]`,
+			5,
+		},
+		{
+			`{1.5: 5}[1]`,
+			nil,
+		},
 	}
 	for _, tt := range tests {
 		evaluated := testEval(tt.input)
@@ -521,3 +761,425 @@ func TestHashIndexExpressions(t *testing.T) {
 		}
 	}
 }
+
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"[0]`, "h"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[2]`, "l"},
+		{`let s = "日本語"; s[len(s) - 1]`, "語"},
+		{`"héllo"[5]`, nil},
+		{`"héllo"[-1]`, nil},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		str, ok := tt.expected.(string)
+		if !ok {
+			testNullObject(t, evaluated)
+			continue
+		}
+		result, ok := evaluated.(*object.String)
+		if !ok {
+			t.Errorf("object is not String. got=%T (%+v)", evaluated, evaluated)
+			continue
+		}
+		if result.Value != str {
+			t.Errorf("String has wrong value. got=%q, want=%q", result.Value, str)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	input := `let café = 1; let 名前 = café + 1; 名前`
+	testIntegerObject(t, testEval(input), 2)
+}
+
+func TestEmptyBlocksEvaluateToNull(t *testing.T) {
+	tests := []string{
+		"fn() {}()",
+		"let f = fn() { let x = 1; }; f()",
+		"let x = if (true) { let y = 1; }; x",
+		"if (true) {}",
+	}
+	for _, input := range tests {
+		testNullObject(t, testEval(input))
+	}
+}
+
+func TestInternalErrorsAreRecovered(t *testing.T) {
+	// a prefix expression without an operand can't come out of the parser, so
+	// evaluating it exercises the recover in Eval
+	node := &ast.PrefixExpression{Operator: "-"}
+	evaluated := Eval(node, object.NewEnvironment())
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if !strings.HasPrefix(errObj.Message, "internal error: ") {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestMaximumCallDepth(t *testing.T) {
+	tests := []string{
+		"let f = fn(n) { f(n + 1) }; f(0);",
+		"let f = fn() { g() }; let g = fn() { f() }; f();",
+	}
+
+	for _, input := range tests {
+		evaluated := testEval(input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("input %q: no error object returned. got=%T(%+v)",
+				input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != "maximum call depth exceeded" {
+			t.Errorf("wrong error message. got=%q", errObj.Message)
+		}
+		if callDepth != 0 {
+			t.Errorf("call depth not unwound. got=%d", callDepth)
+		}
+	}
+
+	// deep but bounded recursion still works
+	input := fmt.Sprintf(`let f = fn(n) { if (n == 0) { 0 } else { 1 + f(n - 1) } }; f(%d)`,
+		maxCallDepth-1)
+	testIntegerObject(t, testEval(input), maxCallDepth-1)
+}
+
+func TestStackTrace(t *testing.T) {
+	input := `let divide = fn(a, b) { a / b };
+let average = fn(xs) { divide(xs[0], len(xs) - 1) };
+fn() { average([1]) }();`
+
+	evaluated := testEval(input)
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "division by zero" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+
+	expected := []object.Frame{
+		{Function: "divide", Pos: token.Position{Offset: 56, Line: 2, Column: 24}},
+		{Function: "average", Pos: token.Position{Offset: 93, Line: 3, Column: 8}},
+		{Function: "<anonymous>", Pos: token.Position{Offset: 86, Line: 3, Column: 1}},
+	}
+	if len(errObj.Trace) != len(expected) {
+		t.Fatalf("wrong trace length. want=%d, got=%d (%+v)",
+			len(expected), len(errObj.Trace), errObj.Trace)
+	}
+	for i, frame := range expected {
+		if errObj.Trace[i] != frame {
+			t.Errorf("trace[%d] wrong. want=%+v, got=%+v", i, frame, errObj.Trace[i])
+		}
+	}
+}
+
+func TestFunctionStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"fn add(a, b) { a + b }; add(2, 3)", 5},
+		{"let x = double(4); fn double(n) { n * 2 }; x", 8},
+		{`
+fn isEven(n) { if (n == 0) { true } else { isOdd(n - 1) } }
+fn isOdd(n) { if (n == 0) { false } else { isEven(n - 1) } }
+if (isEven(10) && isOdd(7)) { 1 } else { 0 }
+`, 1},
+		{"let f = fn() { let r = g(); fn g() { 7 }; r }; f()", 7},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestNamedFunctionInspect(t *testing.T) {
+	evaluated := testEval("fn add(x, y) { x + y }; add")
+	fn, ok := evaluated.(*object.Function)
+	if !ok {
+		t.Fatalf("object is not Function. got=%T (%+v)", evaluated, evaluated)
+	}
+	if fn.Name != "add" {
+		t.Errorf("fn.Name not 'add'. got=%q", fn.Name)
+	}
+	expected := "fn add(x, y) {\n(x + y)\n}"
+	if fn.Inspect() != expected {
+		t.Errorf("fn.Inspect() wrong. want=%q, got=%q", expected, fn.Inspect())
+	}
+}
+
+func TestAssignExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let x = 1; x = 2; x", 2},
+		{"let x = 1; x = x + 1", 2},
+		{"let x = 1; let y = 2; x = y = 3; x + y", 6},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x", 6},
+		{"let n = 0; let inc = fn() { n += 1 }; inc(); inc(); n", 2},
+		{"let x = 1; let f = fn() { let x = 5; x = 6 }; f(); x", 1},
+		{"let a = [1, 2, 3]; a[1] = 5; a[1]", 5},
+		{"let a = [1, 2, 3]; a[2] += 10; a[2]", 13},
+		{"let a = [1]; let b = a; b[0] = 9; a[0]", 9},
+		{`let h = {"a": 1}; h["a"] = 2; h["b"] = 3; h["a"] + h["b"]`, 5},
+		{`let h = {"a": [1]}; h["a"][0] *= 7; h["a"][0]`, 7},
+	}
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(tt.input), tt.expected)
+	}
+}
+
+func TestSelfReferencingContainers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let a = [1]; a[0] = a; a", "[[...]]"},
+		{`let h = {"k": 1}; h["k"] = h; h`, "{k: {...}}"},
+		{`let a = [1]; let h = {"a": a}; a[0] = h; [a, h]`, "[[{a: [...]}], {a: [{...}]}]"},
+		// the same array twice isn't a cycle
+		{"let b = [1]; [b, b]", "[[1], [1]]"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: wrong value. want=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+
+	evaluated := testEval("let a = [1]; a[0] = a; quote(unquote(a))")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "cannot unquote ARRAY, it contains itself" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestAssignErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"x = 1", "assignment to undeclared identifier: x"},
+		{"x += 1", "identifier not found: x"},
+		{"len = 1", "assignment to undeclared identifier: len"},
+		{"let a = [1]; a[1] = 2", "index out of range: 1"},
+		{`let a = [1]; a["0"] = 2`, "array index must be INTEGER, got STRING"},
+		{`let h = {}; h[fn() {}] = 1`, "unusable as hash key: FUNCTION"},
+		{`let s = "abc"; s[0] = "x"`, "index assignment not supported: STRING"},
+		{`let x = "a"; x -= 1`, "type mismatch: STRING - INTEGER"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned for %q. got=%T(%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestWhileStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let i = 0; while (i < 10) { i += 1 }; i", 10},
+		{"let i = 0; while (false) { i = 1 }; i", 0},
+		{"let i = 0; while (true) { i += 1; if (i == 5) { break } }; i", 5},
+		{`
+let i = 0;
+let sum = 0;
+while (i < 10) {
+	i += 1;
+	if (i % 2 == 0) { continue; }
+	sum += i;
+}
+sum`, 25},
+		{`
+let count = 0;
+let i = 0;
+while (i < 3) {
+	let j = 0;
+	while (true) { j += 1; if (j > 2) { break } count += 1 }
+	i += 1;
+}
+count`, 6},
+		{"let f = fn() { let i = 0; while (true) { i += 1; if (i == 3) { return i } } }; f()", 3},
+		// iterative, so this doesn't need a deep Go stack
+		{"let i = 0; while (i < 100000) { i += 1 }; i", 100000},
+		{"while (false) { }", nil},
+		// a break or continue inside an expression leaves it unfinished
+		{"let i = 0; while (true) { i += 1; let x = if (i == 3) { break; }; }; i", 3},
+		{"let n = 0; let i = 0; while (i < 3) { i += 1; n += len([if (i == 2) { continue; }]); }; n", 2},
+		{"let s = 0; for (x in [1, 2, 3]) { s += x * if (x == 2) { continue } else { 1 } }; s", 4},
+		{"let f = fn(x) { x }; let i = 0; while (true) { i += 1; f(if (i == 2) { break }) }; i", 2},
+		{`let i = 0; while (true) { i += 1; let h = {"k": if (i == 4) { break }} }; i`, 4},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		if expected, ok := tt.expected.(int); ok {
+			testIntegerObject(t, evaluated, int64(expected))
+		} else if evaluated != nil {
+			t.Errorf("input %q: expected no value. got=%T (%+v)", tt.input, evaluated, evaluated)
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	// the parser rejects these, so build the AST by hand
+	body := &ast.BlockStatement{Statements: []ast.Statement{&ast.BreakStatement{}}}
+	program := &ast.Program{Statements: []ast.Statement{
+		&ast.ExpressionStatement{Expression: &ast.CallExpression{
+			Function: &ast.FunctionLiteral{Body: body},
+		}},
+	}}
+
+	evaluated := Eval(program, object.NewEnvironment())
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "break outside of a loop" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestForStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"let sum = 0; for (x in [1, 2, 3]) { sum += x }; sum", 6},
+		{"let sum = 0; for (i, x in [10, 20, 30]) { sum += i * x }; sum", 80},
+		{`let s = ""; for (k in {"b": 2, "c": 3, "a": 1}) { s = s + k }; s`, "abc"},
+		{`let s = ""; for (k, v in {"b": "2", "a": "1"}) { s = s + k + v }; s`, "a1b2"},
+		{`let s = ""; for (k, v in {2: "b", 1: "a", true: "t", "x": "x"}) { s = s + v }; s`, "tabx"},
+		{`let s = ""; for (c in "héllo") { s = c + s }; s`, "olléh"},
+		{`let n = 0; for (i, c in "ab") { n += i }; n`, 1},
+		{"let sum = 0; for (i in range(5)) { sum += i }; sum", 10},
+		{"let sum = 0; for (i in range(2, 5)) { sum += i }; sum", 9},
+		{"let sum = 0; for (i in range(10, 0, -3)) { sum += i }; sum", 22},
+		{"let n = 0; for (i in range(5, 0)) { n += 1 }; n", 0},
+		{`
+let sum = 0;
+for (i in range(100)) {
+	if (i % 2 == 1) { continue }
+	if (i > 8) { break }
+	sum += i;
+}
+sum`, 20},
+		{"let f = fn() { for (x in [1, 2, 3]) { if (x == 2) { return x * 10 } } }; f()", 20},
+		{`
+let fns = [];
+for (i in range(3)) { fns = push(fns, fn() { i }) }
+fns[0]() + fns[1]() * 10 + fns[2]() * 100`, 210},
+		{"let x = 5; for (x in [1]) { }; x", 5},
+		{"for (x in 5) { }", "cannot iterate over INTEGER"},
+		{"for (x in [1, 2]) { x + true }", "type mismatch: INTEGER + BOOLEAN"},
+		{"range(0, 1, 0)", "`range` step must not be zero"},
+		{`range("a")`, "arguments to `range` must be INTEGER, got STRING"},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			if errObj, ok := evaluated.(*object.Error); ok {
+				if errObj.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q",
+						expected, errObj.Message)
+				}
+				continue
+			}
+			str, ok := evaluated.(*object.String)
+			if !ok {
+				t.Errorf("input %q: object is not String. got=%T (%+v)",
+					tt.input, evaluated, evaluated)
+				continue
+			}
+			if str.Value != expected {
+				t.Errorf("input %q: String has wrong value. want=%q, got=%q",
+					tt.input, expected, str.Value)
+			}
+		}
+	}
+}
+
+func TestBlockScoping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// a let in a block shadows, it doesn't overwrite
+		{"let x = 1; if (true) { let x = 2; }; x", 1},
+		{"let x = 1; if (true) { let x = 2; x }", 2},
+		{"let x = 1; if (false) { } else { let x = 2; }; x", 1},
+		// assignment still reaches the outer binding
+		{"let x = 1; if (true) { x = 2; }; x", 2},
+		{"let x = 1; if (true) { let x = 5; x = 2; }; x", 1},
+		// blocks see the enclosing scope
+		{"let x = 1; if (true) { let y = x + 1; y }", 2},
+		{"let x = 1; if (true) { if (true) { let y = 2; x + y } }", 3},
+		// and nothing declared in them leaks out
+		{"if (true) { let y = 1; }; y", "identifier not found: y"},
+		{"let i = 0; while (i < 3) { let t = i; i += 1 }; t", "identifier not found: t"},
+		{"for (x in [1]) { let y = x }; y", "identifier not found: y"},
+		{"if (true) { fn g() { 1 } }; g()", "identifier not found: g"},
+		// each iteration gets a fresh block scope
+		{"let n = 0; let i = 0; while (i < 3) { let seen = n; n = seen + 1; i += 1 }; n", 3},
+		// closures keep the block scope alive
+		{"let f = if (true) { let a = 5; fn() { a } }; f()", 5},
+		// function bodies share their scope with the parameters, as before
+		{"let f = fn(x) { let x = x * 2; x }; f(2)", 4},
+		{"let f = fn(x) { if (true) { let x = 10; }; x }; f(2)", 2},
+	}
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("input %q: no error object returned. got=%T(%+v)",
+					tt.input, evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q",
+					expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestTopLevelSharesEnvironment(t *testing.T) {
+	// the REPL evaluates every line as its own program in one environment
+	env := object.NewEnvironment()
+	for _, line := range []string{"let x = 1;", "fn inc(n) { n + 1 }", "let y = inc(x);"} {
+		p, _ := parser.NewParser(lexer.NewLexer(line))
+		Eval(p.ParseProgram(), env)
+	}
+
+	p, _ := parser.NewParser(lexer.NewLexer("x + y"))
+	testIntegerObject(t, Eval(p.ParseProgram(), env), 3)
+}
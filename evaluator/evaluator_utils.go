@@ -2,15 +2,19 @@ package evaluator
 
 import (
 	"fmt"
+	"math"
 
+	"github.com/iZarrios/monkey-lang/ast"
 	"github.com/iZarrios/monkey-lang/object"
 )
 
 // Instead of allocating everytime we stumble upon a distinct value, we are just going to use the same variables
 var (
-	NULL  = &object.Null{}
-	TRUE  = &object.Boolean{Value: true}
-	FALSE = &object.Boolean{Value: false}
+	NULL     = &object.Null{}
+	TRUE     = &object.Boolean{Value: true}
+	FALSE    = &object.Boolean{Value: false}
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
 )
 
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
@@ -21,13 +25,122 @@ func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	}
 }
 
+// Running out of Go stack is fatal and can't be recovered from, so runaway
+// recursion has to be stopped well before that. callDepth counts the function
+// and macro calls in progress; like the rest of the evaluator it assumes one
+// program runs at a time.
+const maxCallDepth = 10000
+
+var callDepth int
+
+// enterCall reports an error if another call would nest too deeply, otherwise
+// the caller must pair it with leaveCall
+func enterCall() *object.Error {
+	if callDepth >= maxCallDepth {
+		return newError("maximum call depth exceeded")
+	}
+	callDepth++
+	return nil
+}
+
+func leaveCall() {
+	callDepth--
+}
+
+// checkBindings reports an unquote(...) in place of a name being bound. Only
+// quote replaces those, anywhere else there's no name to bind.
+func checkBindings(idents ...*ast.Identifier) *object.Error {
+	for _, ident := range idents {
+		if ident != nil && ident.Unquote != nil {
+			err := newError("unquote can only be used inside quote")
+			err.Pos = ident.Pos()
+			return err
+		}
+	}
+	return nil
+}
+
 func newError(format string, a ...interface{}) *object.Error {
 	return &object.Error{Message: fmt.Sprintf(format, a...)}
 }
 
+// intPow computes base ** exp by squaring, exp must not be negative
+func intPow(base, exp int64) int64 {
+	result := int64(1)
+	for exp > 0 {
+		if exp&1 == 1 {
+			result *= base
+		}
+		base *= base
+		exp >>= 1
+	}
+	return result
+}
+
+func isNumber(obj object.Object) bool {
+	t := obj.Type()
+	return t == object.INTEGER_OBJ || t == object.FLOAT_OBJ
+}
+
+// toFloat converts an Integer or Float to a float64
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.Float:
+		return obj.Value
+	default:
+		return 0
+	}
+}
+
 func isError(obj object.Object) bool {
 	if obj != nil {
 		return obj.Type() == object.ERROR_OBJ
 	}
 	return false
 }
+
+// isAbrupt reports whether obj cuts the evaluation of an expression short: an
+// error, or a break or continue on its way out to the enclosing loop
+func isAbrupt(obj object.Object) bool {
+	switch obj.(type) {
+	case *object.Error, *object.Break, *object.Continue:
+		return true
+	}
+	return false
+}
+
+func functionName(fn *object.Function) string {
+	if fn.Name == "" {
+		return "<anonymous>"
+	}
+	return fn.Name
+}
+
+// loopControlError is what a break or continue that got out of every loop
+// turns into. The parser rejects those, but an AST built by hand can have them.
+func loopControlError(signal object.Object) *object.Error {
+	return newError("%s outside of a loop", signal.Inspect())
+}
+
+// rangeLen is the number of values r produces
+func rangeLen(r *object.Range) int64 {
+	var span, step uint64
+	switch {
+	case r.Step > 0 && r.Start < r.Stop:
+		span, step = uint64(r.Stop-r.Start), uint64(r.Step)
+	case r.Step < 0 && r.Start > r.Stop:
+		span, step = uint64(r.Start-r.Stop), uint64(-r.Step)
+	default:
+		return 0
+	}
+	n := span / step
+	if span%step != 0 {
+		n++
+	}
+	if n > math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(n)
+}
@@ -0,0 +1,160 @@
+package evaluator
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	"github.com/iZarrios/monkey-lang/ast"
+)
+
+var gensymCounter uint64
+
+// gensym returns a fresh identifier name. '#' can't appear in identifiers in
+// source code, so the name can't collide with anything the user wrote.
+func gensym(prefix string) string {
+	n := atomic.AddUint64(&gensymCounter, 1)
+	return fmt.Sprintf("%s#%d", prefix, n)
+}
+
+// hygienicBody returns a copy of a macro body in which every name bound inside
+// a quoted template (by let, fn, a parameter or a for loop) is replaced with a
+// fresh one. The code a macro introduces then can't capture or clobber the
+// variables at the expansion site. What gets unquoted or spliced into the
+// template is the caller's code and keeps its names.
+func hygienicBody(body *ast.BlockStatement) *ast.BlockStatement {
+	copied, _ := ast.Copy(body).(*ast.BlockStatement)
+
+	ast.Inspect(copied, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpression)
+		if !ok || call.Function.TokenLiteral() != "quote" || len(call.Arguments) != 1 {
+			return true
+		}
+		renameBindings(call.Arguments[0])
+		return false
+	})
+
+	return copied
+}
+
+// renameBindings gives every name bound in template a fresh one, along with
+// the uses that refer to that binding. A use outside the binding's scope, like
+// an argument that happens to share a parameter's name, keeps its name.
+func renameBindings(template ast.Node) {
+	r := &renamer{}
+	r.push()
+	r.walk(template)
+}
+
+// renamer follows the scopes of the evaluator: a function's parameters and
+// body, a loop's variables and body, and every block. A let binds from the
+// statement after it to the end of its block, a fn statement in the whole
+// block since it's hoisted.
+type renamer struct {
+	scopes []map[string]string
+}
+
+func (r *renamer) push() { r.scopes = append(r.scopes, map[string]string{}) }
+func (r *renamer) pop()  { r.scopes = r.scopes[:len(r.scopes)-1] }
+
+func (r *renamer) bind(ident *ast.Identifier) {
+	// a name unquoted into place is the one the macro author asked for
+	if ident == nil || ident.Unquote != nil {
+		return
+	}
+	renamed := gensym(ident.Value)
+	r.scopes[len(r.scopes)-1][ident.Value] = renamed
+	rename(ident, renamed)
+}
+
+func (r *renamer) lookup(name string) (string, bool) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if renamed, ok := r.scopes[i][name]; ok {
+			return renamed, true
+		}
+	}
+	return "", false
+}
+
+func (r *renamer) walk(node ast.Node) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		if isUnquoteCall(node) || isUnquoteSplicingCall(node) {
+			return false
+		}
+
+		switch node := node.(type) {
+		case *ast.Identifier:
+			if renamed, ok := r.lookup(node.Value); ok && node.Unquote == nil {
+				rename(node, renamed)
+			}
+		case *ast.BlockStatement:
+			r.push()
+			r.walkStatements(node.Statements)
+			r.pop()
+			return false
+		case *ast.FunctionLiteral:
+			r.push()
+			for _, param := range node.Parameters {
+				r.bind(param)
+			}
+			// the body shares its scope with the parameters
+			if node.Body != nil {
+				r.walkStatements(node.Body.Statements)
+			}
+			r.pop()
+			return false
+		case *ast.ForStatement:
+			if node.Iterable != nil {
+				r.walk(node.Iterable)
+			}
+			r.push()
+			r.bind(node.Key)
+			r.bind(node.Value)
+			if node.Body != nil {
+				r.walkStatements(node.Body.Statements)
+			}
+			r.pop()
+			return false
+		}
+		return true
+	})
+}
+
+func (r *renamer) walkStatements(statements []ast.Statement) {
+	for _, statement := range statements {
+		if fs, ok := statement.(*ast.FunctionStatement); ok {
+			r.bind(fs.Name)
+		}
+	}
+
+	for _, statement := range statements {
+		switch statement := statement.(type) {
+		case nil:
+		case *ast.LetStatement:
+			// a function refers to itself by the time it's called
+			if _, ok := statement.Value.(*ast.FunctionLiteral); ok {
+				r.bind(statement.Name)
+				r.walkValue(statement.Value)
+			} else {
+				r.walkValue(statement.Value)
+				r.bind(statement.Name)
+			}
+		case *ast.FunctionStatement:
+			if statement.Function != nil {
+				r.walk(statement.Function)
+			}
+		default:
+			r.walk(statement)
+		}
+	}
+}
+
+func (r *renamer) walkValue(value ast.Expression) {
+	if value != nil {
+		r.walk(value)
+	}
+}
+
+func rename(ident *ast.Identifier, name string) {
+	ident.Value = name
+	ident.Token.Literal = name
+}
@@ -0,0 +1,252 @@
+package evaluator
+
+import (
+	"github.com/iZarrios/monkey-lang/ast"
+	"github.com/iZarrios/monkey-lang/object"
+)
+
+// a macro expanding to a call of itself would otherwise never stop
+const maxExpansionDepth = 1000
+
+// DefineMacros moves every top-level `let name = macro(...) {...}` out of
+// program and into env
+func DefineMacros(program *ast.Program, env *object.Environment) {
+	definitions := []int{}
+
+	for i, statement := range program.Statements {
+		if isMacroDefinition(statement) {
+			addMacro(statement, env)
+			definitions = append(definitions, i)
+		}
+	}
+
+	for i := len(definitions) - 1; i >= 0; i-- {
+		definitionIndex := definitions[i]
+		program.Statements = append(
+			program.Statements[:definitionIndex],
+			program.Statements[definitionIndex+1:]...,
+		)
+	}
+}
+
+func isMacroDefinition(node ast.Statement) bool {
+	letStatement, ok := node.(*ast.LetStatement)
+	if !ok {
+		return false
+	}
+
+	_, ok = letStatement.Value.(*ast.MacroLiteral)
+	return ok
+}
+
+func addMacro(stmt ast.Statement, env *object.Environment) {
+	letStatement, _ := stmt.(*ast.LetStatement)
+	macroLiteral, _ := letStatement.Value.(*ast.MacroLiteral)
+
+	macro := &object.Macro{
+		Parameters: macroLiteral.Parameters,
+		Env:        env,
+		Body:       macroLiteral.Body,
+	}
+
+	env.Set(letStatement.Name.Value, macro)
+}
+
+// ExpandMacros replaces every call of a macro defined in env with the AST the
+// macro returns, which is expanded in turn. Expansion stops at the first
+// error. The arguments of quote, macroexpand and macroexpand1 are left alone.
+func ExpandMacros(program ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	return expandMacros(program, env, 0, false)
+}
+
+// expandMacros expands the macro calls in program. With once set, the code
+// they expand to is left as it is.
+func expandMacros(program ast.Node, env *object.Environment, depth int, once bool) (ast.Node, *object.Error) {
+	var err *object.Error
+
+	skip := unexpandedArguments(program, env, once)
+
+	expanded := ast.Modify(program, func(node ast.Node) ast.Node {
+		if err != nil {
+			return node
+		}
+
+		call, ok := node.(*ast.CallExpression)
+		if !ok || skip[call] {
+			return node
+		}
+		macro, ok := isMacroCall(call, env)
+		if !ok {
+			return node
+		}
+
+		if depth >= maxExpansionDepth {
+			err = newError("macro expansion too deep")
+			err.Pos = call.Function.Pos()
+			return node
+		}
+
+		var result ast.Node
+		result, err = expandMacroCall(call, macro)
+		if err != nil {
+			return node
+		}
+		if once {
+			return result
+		}
+		result, err = expandMacros(result, env, depth+1, false)
+		if err != nil {
+			return node
+		}
+		return result
+	})
+
+	return expanded, err
+}
+
+// unexpandedArguments returns the calls inside the arguments of quote,
+// macroexpand and macroexpand1. A quote keeps the code as it was written, and
+// macroexpand expands it when the call runs, not before. With once set, the
+// calls inside the arguments of a macro call are left for the next step too.
+func unexpandedArguments(program ast.Node, env *object.Environment, once bool) map[*ast.CallExpression]bool {
+	calls := map[*ast.CallExpression]bool{}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		call, ok := node.(*ast.CallExpression)
+		if !ok {
+			return true
+		}
+		if call.Function.TokenLiteral() != "quote" && !isMacroexpandCall(call) {
+			if _, ok := isMacroCall(call, env); !ok || !once {
+				return true
+			}
+		}
+		for _, arg := range call.Arguments {
+			ast.Inspect(arg, func(node ast.Node) bool {
+				if call, ok := node.(*ast.CallExpression); ok {
+					calls[call] = true
+				}
+				return true
+			})
+		}
+		return false
+	})
+
+	return calls
+}
+
+func isMacroexpandCall(call *ast.CallExpression) bool {
+	name := call.Function.TokenLiteral()
+	return name == "macroexpand" || name == "macroexpand1"
+}
+
+// macroexpand evaluates the argument of call to a quote and returns the quote
+// of what it expands to, using the macros set on env. macroexpand1 expands the
+// outermost macro calls in it a single step.
+func macroexpand(call *ast.CallExpression, env *object.Environment) object.Object {
+	name := call.Function.TokenLiteral()
+
+	evaluated := eval(call.Arguments[0], env)
+	if isError(evaluated) {
+		return evaluated
+	}
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		err := newError("argument to `%s` must be QUOTE, got %s", name, evaluated.Type())
+		err.Pos = call.Arguments[0].Pos()
+		return err
+	}
+
+	macros := env.Macros()
+	if macros == nil {
+		// no macros were defined, so nothing expands
+		macros = object.NewEnvironment()
+	}
+
+	// expanding rewrites the tree, and the quote may be expanded again
+	expanded, err := expandMacros(ast.Copy(quote.Node), macros, 0, name == "macroexpand1")
+	if err != nil {
+		return err
+	}
+	return &object.Quote{Node: expanded}
+}
+
+func isMacroCall(exp *ast.CallExpression, env *object.Environment) (*object.Macro, bool) {
+	identifier, ok := exp.Function.(*ast.Identifier)
+	if !ok {
+		return nil, false
+	}
+
+	obj, ok := env.Get(identifier.Value)
+	if !ok {
+		return nil, false
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		return nil, false
+	}
+
+	return macro, true
+}
+
+// expandMacroCall runs the body of macro with the unevaluated arguments of
+// call bound to its parameters, and returns the quoted node it produces
+func expandMacroCall(call *ast.CallExpression, macro *object.Macro) (ast.Node, *object.Error) {
+	if len(call.Arguments) != len(macro.Parameters) {
+		err := newError("wrong number of arguments. got=%d, want=%d",
+			len(call.Arguments), len(macro.Parameters))
+		err.Pos = call.Function.Pos()
+		return nil, err
+	}
+
+	// a macro can recurse through macroexpand without the expansion depth
+	// ever growing
+	if err := enterCall(); err != nil {
+		err.Pos = call.Function.Pos()
+		return nil, err
+	}
+	defer leaveCall()
+
+	args := quoteArgs(call)
+	evalEnv := extendMacroEnv(macro, args)
+
+	evaluated := unwrapReturnValue(Eval(hygienicBody(macro.Body), evalEnv))
+	if err, ok := evaluated.(*object.Error); ok {
+		return nil, err
+	}
+
+	quote, ok := evaluated.(*object.Quote)
+	if !ok {
+		err := newError("macro must return a quoted AST node, got %s", evaluated.Type())
+		err.Pos = call.Function.Pos()
+		return nil, err
+	}
+
+	return quote.Node, nil
+}
+
+func quoteArgs(exp *ast.CallExpression) []*object.Quote {
+	args := []*object.Quote{}
+
+	for _, a := range exp.Arguments {
+		args = append(args, &object.Quote{Node: a})
+	}
+
+	return args
+}
+
+func extendMacroEnv(
+	macro *object.Macro,
+	args []*object.Quote,
+) *object.Environment {
+	extended := object.NewEnclosedEnvironment(macro.Env)
+	// a macro body can expand the macros defined next to it
+	extended.SetMacros(macro.Env)
+
+	for paramIdx, param := range macro.Parameters {
+		extended.Set(param.Value, args[paramIdx])
+	}
+
+	return extended
+}
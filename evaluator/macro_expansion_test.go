@@ -0,0 +1,600 @@
+package evaluator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iZarrios/monkey-lang/ast"
+	"github.com/iZarrios/monkey-lang/lexer"
+	"github.com/iZarrios/monkey-lang/object"
+	"github.com/iZarrios/monkey-lang/parser"
+	"github.com/iZarrios/monkey-lang/token"
+)
+
+func TestDefineMacros(t *testing.T) {
+	input := `
+	let number = 1;
+	let function = fn(x, y) { x + y };
+	let mymacro = macro(x, y) { x + y; };
+	`
+
+	env := object.NewEnvironment()
+	program := testParseProgram(input)
+
+	DefineMacros(program, env)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("Wrong number of statements. got=%d",
+			len(program.Statements))
+	}
+
+	_, ok := env.Get("number")
+	if ok {
+		t.Fatalf("number should not be defined")
+	}
+	_, ok = env.Get("function")
+	if ok {
+		t.Fatalf("function should not be defined")
+	}
+
+	obj, ok := env.Get("mymacro")
+	if !ok {
+		t.Fatalf("macro not in environment.")
+	}
+
+	macro, ok := obj.(*object.Macro)
+	if !ok {
+		t.Fatalf("object is not Macro. got=%T (%+v)", obj, obj)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("Wrong number of macro parameters. got=%d",
+			len(macro.Parameters))
+	}
+
+	if macro.Parameters[0].String() != "x" {
+		t.Fatalf("parameter is not 'x'. got=%q", macro.Parameters[0])
+	}
+	if macro.Parameters[1].String() != "y" {
+		t.Fatalf("parameter is not 'y'. got=%q", macro.Parameters[1])
+	}
+
+	expectedBody := "(x + y)"
+
+	if macro.Body.String() != expectedBody {
+		t.Fatalf("body is not %q. got=%q", expectedBody, macro.Body.String())
+	}
+}
+
+func testParseProgram(input string) *ast.Program {
+	l := lexer.NewLexer(input)
+	p, _ := parser.NewParser(l)
+	return p.ParseProgram()
+}
+
+func TestExpandMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`
+			let infixExpression = macro() { quote(1 + 2); };
+
+			infixExpression();
+			`,
+			`(1 + 2)`,
+		},
+		{
+			`
+			let reverse = macro(a, b) { quote(unquote(b) - unquote(a)); };
+
+			reverse(2 + 2, 10 - 5);
+			`,
+			`(10 - 5) - (2 + 2)`,
+		},
+		{
+			`
+			let unless = macro(condition, consequence, alternative) {
+				quote(if (!(unquote(condition))) {
+					unquote(consequence);
+				} else {
+					unquote(alternative);
+				});
+			};
+
+			unless(10 > 5, puts("not greater"), puts("greater"));
+			`,
+			`if (!(10 > 5)) { puts("not greater") } else { puts("greater") }`,
+		},
+		{
+			// a macro can be used more than once
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+
+			double(1);
+			double(3);
+			`,
+			`(1 * 2); (3 * 2)`,
+		},
+		{
+			// calls nested in arguments and results are expanded too
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			let quadruple = macro(x) { quote(double(double(unquote(x)))) };
+
+			puts(double(1));
+			quadruple(1);
+			`,
+			`puts((1 * 2)); ((1 * 2) * 2)`,
+		},
+		{
+			// a quote keeps the code as it was written
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+
+			let q = quote(double(1));
+			double(quote(double(2)));
+			`,
+			`let q = quote(double(1)); (quote(double(2)) * 2)`,
+		},
+	}
+
+	for _, tt := range tests {
+		expected := testParseProgram(tt.expected)
+		program := testParseProgram(tt.input)
+
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+		expanded, err := ExpandMacros(program, env)
+		if err != nil {
+			t.Errorf("ExpandMacros returned error: %s", err.Message)
+			continue
+		}
+
+		if expanded.String() != expected.String() {
+			t.Errorf("not equal. want=%q, got=%q",
+				expected.String(), expanded.String())
+		}
+	}
+}
+
+func TestExpandMacrosErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedLine    int
+	}{
+		{
+			"let m = macro(a, b) { quote(a) };\nm(1)",
+			"wrong number of arguments. got=1, want=2",
+			2,
+		},
+		{
+			"let m = macro() { 1 };\nm()",
+			"macro must return a quoted AST node, got INTEGER",
+			2,
+		},
+		{
+			"let m = macro() { 1 + true };\n\nm()",
+			"type mismatch: INTEGER + BOOLEAN",
+			1,
+		},
+		{
+			"let m = macro() { quote(m()) };\nm()",
+			"macro expansion too deep",
+			1,
+		},
+		{
+			"let m = macro(xs) { quote(f(unquote_splicing(xs))) };\nm(5)",
+			"quoted argument to `unquote_splicing` must be an array literal or a block, got 5",
+			1,
+		},
+	}
+
+	for _, tt := range tests {
+		program := testParseProgram(tt.input)
+		env := object.NewEnvironment()
+		DefineMacros(program, env)
+
+		_, err := ExpandMacros(program, env)
+		if err == nil {
+			t.Errorf("input %q: no error returned", tt.input)
+			continue
+		}
+		if err.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, err.Message)
+		}
+		if err.Pos.Line != tt.expectedLine {
+			t.Errorf("input %q: wrong error line. expected=%d, got=%d",
+				tt.input, tt.expectedLine, err.Pos.Line)
+		}
+	}
+}
+
+func TestMacroLiteralOutsideTopLevelLet(t *testing.T) {
+	evaluated := testEval("let f = fn() { macro(x) { x } }; f()")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+	if errObj.Message != "macros can only be defined with a top-level let" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func testExpandAndEval(input string) object.Object {
+	program := testParseProgram(input)
+	macroEnv := object.NewEnvironment()
+	DefineMacros(program, macroEnv)
+	expanded, err := ExpandMacros(program, macroEnv)
+	if err != nil {
+		return err
+	}
+	env := object.NewEnvironment()
+	env.SetMacros(macroEnv)
+	return Eval(expanded, env)
+}
+
+func TestMacroHygiene(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			// the tmp the macro introduces doesn't clobber the caller's tmp
+			`
+			let swap = macro(a, b) {
+				quote(if (true) {
+					let tmp = unquote(a);
+					unquote(a) = unquote(b);
+					unquote(b) = tmp;
+				})
+			};
+			let tmp = 1;
+			let other = 2;
+			swap(tmp, other);
+			tmp * 10 + other
+			`,
+			21,
+		},
+		{
+			// nor does its parameter capture the caller's variable of the same name
+			`
+			let unless = macro(cond, body) {
+				quote(fn(cond) { if (!cond) { unquote(body) } }(unquote(cond)))
+			};
+			let cond = 5;
+			unless(false, cond)
+			`,
+			5,
+		},
+		{
+			// loop variables and named functions are renamed too
+			`
+			let sum = macro(arr) {
+				quote(if (true) {
+					let total = 0;
+					fn add(n) { total += n }
+					for (x in unquote(arr)) { add(x) }
+					total
+				})
+			};
+			let x = [1, 2];
+			let total = 100;
+			let add = 1000;
+			sum(x) + total + add
+			`,
+			1103,
+		},
+		{
+			// every expansion gets its own names
+			`
+			let once = macro(expr) { quote(fn() { let v = unquote(expr); v }()) };
+			let v = 1;
+			once(once(v) + 1)
+			`,
+			2,
+		},
+		{
+			// only uses within the parameter's scope are renamed
+			`
+			let x = 10;
+			let m = macro() { quote(fn(x) { x * 2 }(x)) };
+			m()
+			`,
+			20,
+		},
+		{
+			// a let binds from the next statement to the end of its block
+			`
+			let n = 5;
+			let m = macro() {
+				quote(fn() {
+					let r = if (true) { let n = n + 1; n };
+					r * 100 + n
+				}())
+			};
+			m()
+			`,
+			605,
+		},
+		{
+			// a recursive function refers to itself under its new name
+			`
+			let fact = 1000;
+			let m = macro(k) {
+				quote(if (true) {
+					let fact = fn(n) { if (n == 0) { 1 } else { n * fact(n - 1) } };
+					fact(unquote(k))
+				})
+			};
+			m(4) + fact
+			`,
+			1024,
+		},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testExpandAndEval(tt.input), tt.expected)
+	}
+}
+
+func TestGensym(t *testing.T) {
+	evaluated := testEval(`[gensym(), gensym(), gensym("tmp")]`)
+	arr, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	seen := map[string]bool{}
+	for i, el := range arr.Elements {
+		quote, ok := el.(*object.Quote)
+		if !ok {
+			t.Fatalf("element %d is not Quote. got=%T (%+v)", i, el, el)
+		}
+		ident, ok := quote.Node.(*ast.Identifier)
+		if !ok {
+			t.Fatalf("element %d is not a quoted Identifier. got=%T", i, quote.Node)
+		}
+		if seen[ident.Value] {
+			t.Errorf("gensym returned %q twice", ident.Value)
+		}
+		seen[ident.Value] = true
+	}
+
+	last := arr.Elements[2].(*object.Quote).Node.(*ast.Identifier).Value
+	if !strings.HasPrefix(last, "tmp#") {
+		t.Errorf("gensym(\"tmp\") not prefixed with tmp#. got=%q", last)
+	}
+
+	evaluated = testEval("gensym(1)")
+	errObj, ok := evaluated.(*object.Error)
+	if !ok || errObj.Message != "argument to `gensym` must be STRING, got INTEGER" {
+		t.Errorf("wrong result for gensym(1). got=%T (%+v)", evaluated, evaluated)
+	}
+}
+
+func TestGensymBindings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			`
+			let with_count = macro(xs, body) {
+				let count = gensym("count");
+				let x = gensym();
+				quote(fn() {
+					let unquote(count) = 0;
+					for (unquote(x) in unquote(xs)) { unquote(count) += 1 }
+					unquote(body) * 10 + unquote(count)
+				}())
+			};
+			let count = 7;
+			with_count([1, 2, 3], count)
+			`,
+			73,
+		},
+		{
+			`
+			let apply = macro(body) {
+				let arg = gensym("arg");
+				quote(fn(unquote(arg)) { unquote(body) + unquote(arg) }(1))
+			};
+			let arg = 40;
+			apply(arg + 1)
+			`,
+			42,
+		},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testExpandAndEval(tt.input), tt.expected)
+	}
+}
+
+func TestUnquoteBindingErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedPos     token.Position
+	}{
+		{
+			"let unquote(x) = 1;",
+			"unquote can only be used inside quote",
+			token.Position{Offset: 4, Line: 1, Column: 5},
+		},
+		{
+			"for (unquote(x) in [1]) { 1 }",
+			"unquote can only be used inside quote",
+			token.Position{Offset: 5, Line: 1, Column: 6},
+		},
+		{
+			"fn(unquote(x)) { 1 }(2)",
+			"unquote can only be used inside quote",
+			token.Position{Offset: 3, Line: 1, Column: 4},
+		},
+		{
+			"quote(fn(unquote(5)) { 1 })",
+			"cannot bind to 5, unquote must give an identifier",
+			token.Position{Offset: 9, Line: 1, Column: 10},
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("input %q: no error object returned. got=%T(%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+		if errObj.Pos != tt.expectedPos {
+			t.Errorf("input %q: wrong error position. expected=%s, got=%s",
+				tt.input, tt.expectedPos, errObj.Pos)
+		}
+	}
+}
+
+func TestMacroexpand(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`macroexpand(quote(1 + 2))`,
+			`(1 + 2)`,
+		},
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			let quadruple = macro(x) { quote(double(double(unquote(x)))) };
+			macroexpand(quote(quadruple(a)))
+			`,
+			`((a * 2) * 2)`,
+		},
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			let quadruple = macro(x) { quote(double(double(unquote(x)))) };
+			macroexpand1(quote(quadruple(a)))
+			`,
+			`double(double(a))`,
+		},
+		{
+			// every outermost call in the quote is expanded a single step
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			let quadruple = macro(x) { quote(double(double(unquote(x)))) };
+			macroexpand1(quote(quadruple(a) + double(b)))
+			`,
+			`(double(double(a)) + (b * 2))`,
+		},
+		{
+			// the quote is left as it was, each call expands it a step
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			let q = quote(double(double(a)));
+			macroexpand1(q)
+			`,
+			`(double(a) * 2)`,
+		},
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			let q = quote(double(double(a)));
+			macroexpand1(macroexpand1(q))
+			`,
+			`((a * 2) * 2)`,
+		},
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			let n = 3;
+			macroexpand(quote(double(unquote(n + 1))))
+			`,
+			`(4 * 2)`,
+		},
+		{
+			// the macros are kept apart from the variables
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			let double = 5;
+			macroexpand(quote(double(a)))
+			`,
+			`(a * 2)`,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testExpandAndEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Errorf("input %q: expected *object.Quote. got=%T (%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q",
+				quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestMacroexpandErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{
+			`
+			let forever = macro() { macroexpand(quote(forever())) };
+			forever()
+			`,
+			"maximum call depth exceeded",
+		},
+		{
+			`macroexpand(5)`,
+			"argument to `macroexpand` must be QUOTE, got INTEGER",
+		},
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			double = 5;
+			`,
+			"assignment to undeclared identifier: double",
+		},
+		{
+			`macroexpand1(quote(1), quote(2))`,
+			"wrong number of arguments. got=2, want=1",
+		},
+		{
+			`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			macroexpand(quote(double(1, 2)))
+			`,
+			"wrong number of arguments. got=2, want=1",
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testExpandAndEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("input %q: no error object returned. got=%T(%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+	}
+}
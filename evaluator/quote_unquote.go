@@ -9,30 +9,224 @@ import (
 )
 
 func quote(node ast.Node, env *object.Environment) object.Object {
-	node = evalUnquoteCalls(node, env)
+	// unquoting rewrites the tree, and the same quote may be evaluated again
+	node, err := evalUnquoteCalls(ast.Copy(node), env)
+	if err != nil {
+		return err
+	}
 	return &object.Quote{Node: node}
 }
 
-func evalUnquoteCalls(quoted ast.Node, env *object.Environment) ast.Node {
+// evalUnquoteCalls replaces every unquote call in quoted with the AST node for
+// the value of its argument, and every unquote_splicing call with the nodes for
+// the elements of its array argument. It stops at the first error.
+func evalUnquoteCalls(quoted ast.Node, env *object.Environment) (ast.Node, *object.Error) {
+	var err *object.Error
 
-	return ast.Modify(quoted, func(node ast.Node) ast.Node {
-		if !isUnquoteCall(node) {
+	node := ast.Modify(quoted, func(node ast.Node) ast.Node {
+		if err != nil {
 			return node
 		}
 
-		call, ok := node.(*ast.CallExpression)
-		if !ok {
-			return node
+		// Modify visits children first, so a splice has not been touched
+		// yet when the list around it is rewritten
+		switch node := node.(type) {
+		case *ast.CallExpression:
+			if isUnquoteCall(node) {
+				var converted ast.Node
+				converted, err = evalUnquoteCall(node, env)
+				if err != nil {
+					return node
+				}
+				return converted
+			}
+			node.Arguments, err = spliceExpressions(node.Arguments, env)
+		case *ast.ArrayLiteral:
+			node.Elements, err = spliceExpressions(node.Elements, env)
+		case *ast.BlockStatement:
+			node.Statements, err = spliceStatements(node.Statements, env)
+		case *ast.Identifier:
+			if node.Unquote != nil {
+				var ident *ast.Identifier
+				ident, err = evalUnquoteBinding(node, env)
+				if err != nil {
+					return node
+				}
+				return ident
+			}
 		}
+		return node
+	})
+	if err != nil {
+		return node, err
+	}
 
-		if len(call.Arguments) != 1 {
-			return node
+	// whatever is left wasn't in a list it could be spliced into
+	ast.Inspect(node, func(node ast.Node) bool {
+		if err != nil {
+			return false
 		}
-		unquoted := Eval(call.Arguments[0], env)
+		if call, ok := node.(*ast.CallExpression); ok && isUnquoteSplicingCall(call) {
+			err = newError("unquote_splicing is only allowed in argument lists, array literals and blocks")
+			err.Pos = call.Function.Pos()
+		}
+		return true
+	})
 
-		return convertObjectToASTNode(unquoted)
+	return node, err
+}
 
-	})
+func evalUnquoteCall(call *ast.CallExpression, env *object.Environment) (ast.Node, *object.Error) {
+	if len(call.Arguments) != 1 {
+		err := newError("wrong number of arguments. got=%d, want=1", len(call.Arguments))
+		err.Pos = call.Function.Pos()
+		return nil, err
+	}
+
+	unquoted := eval(call.Arguments[0], env)
+	if err, ok := unquoted.(*object.Error); ok {
+		return nil, err
+	}
+	return convertObjectToASTNode(unquoted, call.Function.Pos())
+}
+
+// evalUnquoteBinding returns the identifier that replaces an unquote(...) in
+// place of a name being bound, such as one made by gensym
+func evalUnquoteBinding(binding *ast.Identifier, env *object.Environment) (*ast.Identifier, *object.Error) {
+	converted, err := evalUnquoteCall(binding.Unquote, env)
+	if err != nil {
+		return nil, err
+	}
+
+	ident, ok := converted.(*ast.Identifier)
+	if !ok || ident.Unquote != nil {
+		err := newError("cannot bind to %s, unquote must give an identifier", converted)
+		err.Pos = binding.Pos()
+		return nil, err
+	}
+
+	return &ast.Identifier{
+		Token: token.Token{Type: token.IDENT, Literal: ident.Value, Pos: binding.Pos()},
+		Value: ident.Value,
+	}, nil
+}
+
+// spliceExpressions returns exps with every unquote_splicing call replaced by
+// the elements of its array
+func spliceExpressions(exps []ast.Expression, env *object.Environment) ([]ast.Expression, *object.Error) {
+	spliced := make([]ast.Expression, 0, len(exps))
+	for _, exp := range exps {
+		call, ok := exp.(*ast.CallExpression)
+		if !ok || !isUnquoteSplicingCall(call) {
+			spliced = append(spliced, exp)
+			continue
+		}
+
+		elements, err := evalUnquoteSplicing(call, env)
+		if err != nil {
+			return exps, err
+		}
+		for _, el := range elements {
+			node, err := convertObjectToExpression(el, call.Function.Pos())
+			if err != nil {
+				return exps, err
+			}
+			spliced = append(spliced, node)
+		}
+	}
+	return spliced, nil
+}
+
+// spliceStatements is spliceExpressions for the statements of a block. The
+// splice is a statement of its own, and expressions spliced in become
+// expression statements.
+func spliceStatements(stmts []ast.Statement, env *object.Environment) ([]ast.Statement, *object.Error) {
+	spliced := make([]ast.Statement, 0, len(stmts))
+	for _, stmt := range stmts {
+		call := spliceCall(stmt)
+		if call == nil {
+			spliced = append(spliced, stmt)
+			continue
+		}
+
+		elements, err := evalUnquoteSplicing(call, env)
+		if err != nil {
+			return stmts, err
+		}
+		for _, el := range elements {
+			node, err := convertObjectToASTNode(el, call.Function.Pos())
+			if err != nil {
+				return stmts, err
+			}
+			switch node := node.(type) {
+			case ast.Statement:
+				spliced = append(spliced, node)
+			case ast.Expression:
+				t := token.Token{Literal: node.TokenLiteral(), Pos: node.Pos()}
+				spliced = append(spliced, &ast.ExpressionStatement{Token: t, Expression: node})
+			}
+		}
+	}
+	return spliced, nil
+}
+
+// spliceCall returns the unquote_splicing call stmt consists of, if any
+func spliceCall(stmt ast.Statement) *ast.CallExpression {
+	es, ok := stmt.(*ast.ExpressionStatement)
+	if !ok || !isUnquoteSplicingCall(es.Expression) {
+		return nil
+	}
+	call, _ := es.Expression.(*ast.CallExpression)
+	return call
+}
+
+func evalUnquoteSplicing(call *ast.CallExpression, env *object.Environment) ([]object.Object, *object.Error) {
+	if len(call.Arguments) != 1 {
+		err := newError("wrong number of arguments. got=%d, want=1", len(call.Arguments))
+		err.Pos = call.Function.Pos()
+		return nil, err
+	}
+
+	evaluated := eval(call.Arguments[0], env)
+	switch evaluated := evaluated.(type) {
+	case *object.Error:
+		return nil, evaluated
+	case *object.Array:
+		return evaluated.Elements, nil
+	case *object.Quote:
+		// a macro gets its arguments quoted, an array literal among them
+		// splices in its elements
+		if elements, ok := quotedElements(evaluated.Node); ok {
+			return elements, nil
+		}
+		err := newError("quoted argument to `unquote_splicing` must be an array literal or a block, got %s",
+			evaluated.Node)
+		err.Pos = call.Function.Pos()
+		return nil, err
+	default:
+		err := newError("argument to `unquote_splicing` must be ARRAY, got %s", evaluated.Type())
+		err.Pos = call.Function.Pos()
+		return nil, err
+	}
+}
+
+// quotedElements returns the elements of an array literal or the statements
+// of a block, each quoted on its own
+func quotedElements(node ast.Node) ([]object.Object, bool) {
+	elements := []object.Object{}
+	switch node := node.(type) {
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			elements = append(elements, &object.Quote{Node: el})
+		}
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			elements = append(elements, &object.Quote{Node: stmt})
+		}
+	default:
+		return nil, false
+	}
+	return elements, true
 }
 
 func isUnquoteCall(node ast.Node) bool {
@@ -44,25 +238,143 @@ func isUnquoteCall(node ast.Node) bool {
 	return callExpression.Function.TokenLiteral() == "unquote"
 }
 
-func convertObjectToASTNode(obj object.Object) ast.Node {
+func isUnquoteSplicingCall(node ast.Node) bool {
+	callExpression, ok := node.(*ast.CallExpression)
+	if !ok {
+		return false
+	}
+
+	return callExpression.Function.TokenLiteral() == "unquote_splicing"
+}
+
+// convertObjectToASTNode turns a value back into the literal that evaluates to
+// it. The nodes are placed at pos, the unquote they replace, so errors in the
+// expanded code point somewhere sensible.
+func convertObjectToASTNode(obj object.Object, pos token.Position) (ast.Node, *object.Error) {
+	return convertValue(obj, pos, map[object.Object]bool{})
+}
+
+// convertValue is convertObjectToASTNode for a value inside the containers in
+// seen. A container that holds itself has no literal form.
+func convertValue(obj object.Object, pos token.Position, seen map[object.Object]bool) (ast.Node, *object.Error) {
+	switch obj.(type) {
+	case *object.Array, *object.Hash:
+		if seen[obj] {
+			err := newError("cannot unquote %s, it contains itself", obj.Type())
+			err.Pos = pos
+			return nil, err
+		}
+		seen[obj] = true
+		defer delete(seen, obj)
+	}
+
 	switch obj := obj.(type) {
 	case *object.Integer:
 		t := token.Token{
 			Type:    token.INT,
 			Literal: fmt.Sprintf("%d", obj.Value),
+			Pos:     pos,
 		}
-		return &ast.IntegerLiteral{Token: t, Value: obj.Value}
+		return &ast.IntegerLiteral{Token: t, Value: obj.Value}, nil
+	case *object.Float:
+		t := token.Token{Type: token.FLOAT, Literal: obj.Inspect(), Pos: pos}
+		return &ast.FloatLiteral{Token: t, Value: obj.Value}, nil
 	case *object.Boolean:
 		var t token.Token
 		if obj.Value {
-			t = token.Token{Type: token.TRUE, Literal: "true"}
+			t = token.Token{Type: token.TRUE, Literal: "true", Pos: pos}
 		} else {
-			t = token.Token{Type: token.FALSE, Literal: "false"}
+			t = token.Token{Type: token.FALSE, Literal: "false", Pos: pos}
+		}
+		return &ast.Boolean{Token: t, Value: obj.Value}, nil
+	case *object.String:
+		t := token.Token{Type: token.STRING, Literal: obj.Value, Pos: pos}
+		return &ast.StringLiteral{Token: t, Value: obj.Value}, nil
+	case *object.Null:
+		t := token.Token{Type: token.NULL, Literal: "null", Pos: pos}
+		return &ast.NullLiteral{Token: t}, nil
+	case *object.Array:
+		elements := make([]ast.Expression, len(obj.Elements))
+		for i, el := range obj.Elements {
+			node, err := convertExpression(el, pos, seen)
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = node
+		}
+		t := token.Token{Type: token.LBRACKET, Literal: "[", Pos: pos}
+		return &ast.ArrayLiteral{Token: t, Elements: elements}, nil
+	case *object.Hash:
+		pairs := make(map[ast.Expression]ast.Expression, len(obj.Pairs))
+		for _, pair := range obj.SortedPairs() {
+			key, err := convertExpression(pair.Key, pos, seen)
+			if err != nil {
+				return nil, err
+			}
+			value, err := convertExpression(pair.Value, pos, seen)
+			if err != nil {
+				return nil, err
+			}
+			pairs[key] = value
+		}
+		t := token.Token{Type: token.LBRACE, Literal: "{", Pos: pos}
+		return &ast.HashLiteral{Token: t, Pairs: pairs}, nil
+	case *object.Function:
+		// the literal is evaluated again where it's spliced in, so it closes
+		// over the environment there rather than the one it was created in.
+		// The local variables it used would be gone.
+		if name, ok := capturedVariable(obj); ok {
+			err := newError("cannot unquote %s, it closes over the local variable %s", obj.Type(), name)
+			err.Pos = pos
+			return nil, err
 		}
-		return &ast.Boolean{Token: t, Value: obj.Value}
+		t := token.Token{Type: token.FUNCTION, Literal: "fn", Pos: pos}
+		literal := &ast.FunctionLiteral{Token: t, Parameters: obj.Parameters, Body: obj.Body, Name: obj.Name}
+		return ast.Copy(literal), nil
 	case *object.Quote:
-		return obj.Node
+		return obj.Node, nil
 	default:
-		return nil
+		err := newError("cannot unquote %s, it has no literal form", obj.Type())
+		err.Pos = pos
+		return nil, err
+	}
+}
+
+// capturedVariable returns a name the body of fn uses that isn't one of its
+// parameters and is bound in a local scope of the environment fn closes over
+func capturedVariable(fn *object.Function) (string, bool) {
+	params := map[string]bool{}
+	for _, param := range fn.Parameters {
+		params[param.Value] = true
+	}
+
+	var name string
+	ast.Inspect(fn.Body, func(node ast.Node) bool {
+		ident, ok := node.(*ast.Identifier)
+		if name == "" && ok && !params[ident.Value] && fn.Env.BoundLocally(ident.Value) {
+			name = ident.Value
+		}
+		return name == ""
+	})
+	return name, name != ""
+}
+
+// convertObjectToExpression is convertObjectToASTNode for places that need an
+// expression, such as array elements
+func convertObjectToExpression(obj object.Object, pos token.Position) (ast.Expression, *object.Error) {
+	return convertExpression(obj, pos, map[object.Object]bool{})
+}
+
+func convertExpression(obj object.Object, pos token.Position, seen map[object.Object]bool) (ast.Expression, *object.Error) {
+	node, err := convertValue(obj, pos, seen)
+	if err != nil {
+		return nil, err
+	}
+	exp, ok := node.(ast.Expression)
+	if !ok {
+		err := newError("cannot unquote a statement into an expression")
+		err.Pos = pos
+		return nil, err
 	}
+	return exp, nil
 }
@@ -3,7 +3,9 @@ package evaluator
 import (
 	"testing"
 
+	"github.com/iZarrios/monkey-lang/ast"
 	"github.com/iZarrios/monkey-lang/object"
+	"github.com/iZarrios/monkey-lang/token"
 )
 
 func TestQuote(t *testing.T) {
@@ -70,6 +72,34 @@ func TestQuote(t *testing.T) {
             quote(unquote(4 + 4) + unquote(quotedInfixExpression))`,
 			`(8 + (4 + 4))`,
 		},
+		{
+			`quote(unquote("hello") + "world")`,
+			`(hello + world)`,
+		},
+		{
+			`quote(unquote(1.5) * unquote(2.0))`,
+			`(1.5 * 2.0)`,
+		},
+		{
+			`quote(unquote(null))`,
+			`null`,
+		},
+		{
+			`quote(unquote(if (false) { 1 }))`,
+			`null`,
+		},
+		{
+			`quote(unquote([1, "a", [true, -2]]))`,
+			`[1, a, [true, -2]]`,
+		},
+		{
+			`quote(unquote({"a": [1]}))`,
+			`{a:[1]}`,
+		},
+		{
+			`quote(unquote(fn(x) { x + 1 }))`,
+			`fn(x)(x + 1)`,
+		},
 	}
 
 	for _, tt := range tests {
@@ -90,3 +120,279 @@ func TestQuote(t *testing.T) {
 		}
 	}
 }
+
+func TestQuoteEvaluatedTwice(t *testing.T) {
+	input := `let f = fn(x) { quote(unquote(x) + 1) }; let a = f(1); let b = f(2); [a, b]`
+
+	evaluated := testEval(input)
+	arr, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("expected *object.Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	for i, expected := range []string{"(1 + 1)", "(2 + 1)"} {
+		quote, ok := arr.Elements[i].(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote. got=%T (%+v)", arr.Elements[i], arr.Elements[i])
+		}
+		if quote.Node.String() != expected {
+			t.Errorf("not equal. got=%q, want=%q", quote.Node.String(), expected)
+		}
+	}
+}
+
+func TestUnquotedValuesEvaluateToThemselves(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let m = macro() { quote(unquote("a\tb")) }; m()`, "a\tb"},
+		{`let m = macro() { quote(unquote(2.0)) }; m()`, "2.0"},
+		{`let m = macro() { quote(unquote(-7)) }; m()`, "-7"},
+		{`let m = macro() { quote(unquote(null)) }; m()`, "null"},
+		{`let m = macro() { quote(unquote([1, [2.5, "x"]])) }; m()`, "[1, [2.5, x]]"},
+		{`let m = macro() { quote(unquote({"b": 2, "a": {1: true}})) }; m()`, "{a: {1: true}, b: 2}"},
+		{`let m = macro() { quote(unquote({"a": [1, 2]})) }; m()["a"][1]`, "2"},
+		{`let m = macro() { let f = fn(x) { x * 3 }; quote(unquote(f)(2)) }; m()`, "6"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testExpandAndEval(tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("input %q: wrong value. want=%q, got=%q",
+				tt.input, tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestUnquoteErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedPos     token.Position
+	}{
+		{
+			"quote(1 + unquote(len))",
+			"cannot unquote BUILTIN, it has no literal form",
+			token.Position{Offset: 10, Line: 1, Column: 11},
+		},
+		{
+			"quote(\n  unquote([1, puts]))",
+			"cannot unquote BUILTIN, it has no literal form",
+			token.Position{Offset: 9, Line: 2, Column: 3},
+		},
+		{
+			`quote(unquote({"f": range(3)}))`,
+			"cannot unquote RANGE, it has no literal form",
+			token.Position{Offset: 6, Line: 1, Column: 7},
+		},
+		{
+			"quote(unquote(1 + true))",
+			"type mismatch: INTEGER + BOOLEAN",
+			token.Position{Offset: 16, Line: 1, Column: 17},
+		},
+		{
+			"quote(unquote(1, 2))",
+			"wrong number of arguments. got=2, want=1",
+			token.Position{Offset: 6, Line: 1, Column: 7},
+		},
+		{
+			"let c = fn(y) { fn(x) { x + y } }(10);\nquote(unquote(c)(3))",
+			"cannot unquote FUNCTION, it closes over the local variable y",
+			token.Position{Offset: 45, Line: 2, Column: 7},
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("input %q: no error object returned. got=%T(%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+		if errObj.Pos != tt.expectedPos {
+			t.Errorf("input %q: wrong error position. expected=%s, got=%s",
+				tt.input, tt.expectedPos, errObj.Pos)
+		}
+	}
+}
+
+func TestQuoteUnquoteSplicing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{
+			`quote(f(1, unquote_splicing([2, 3]), 4))`,
+			`f(1, 2, 3, 4)`,
+		},
+		{
+			`quote(f(unquote_splicing([])))`,
+			`f()`,
+		},
+		{
+			`let xs = [quote(a + b), "c"];
+			quote([0, unquote_splicing(xs), unquote_splicing(xs)])`,
+			`[0, (a + b), c, (a + b), c]`,
+		},
+		{
+			`quote(if (x) { unquote_splicing([quote(puts(1)), 2]); 3 })`,
+			`ifx puts(1)23`,
+		},
+		{
+			`quote(fn() { unquote_splicing([1, 2]) })`,
+			`fn()12`,
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		quote, ok := evaluated.(*object.Quote)
+		if !ok {
+			t.Fatalf("expected *object.Quote. got=%T (%+v)",
+				evaluated, evaluated)
+		}
+
+		if quote.Node.String() != tt.expected {
+			t.Errorf("not equal. got=%q, want=%q",
+				quote.Node.String(), tt.expected)
+		}
+	}
+}
+
+func TestUnquoteSplicingInMacros(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{
+			`
+			let sum = fn(a, b, c) { a + b + c };
+			let thrice = macro(x) { quote(sum(unquote_splicing([x, x, x]))) };
+			thrice(1 + 1)
+			`,
+			6,
+		},
+		{
+			`
+			let do = macro(a, b) { quote(if (true) { unquote_splicing([a, b]) }) };
+			let x = 1;
+			do(x = x + 1, x * 10)
+			`,
+			20,
+		},
+		{
+			// the statements spliced in are the caller's and aren't renamed
+			`
+			let twice = macro(body) { quote(if (true) { unquote_splicing([body, body]) }) };
+			let x = 1;
+			twice(x = x * 3);
+			x
+			`,
+			9,
+		},
+		{
+			`
+			let add = fn(a, b) { a + b };
+			let total = macro(a, b) {
+				quote(if (true) { let t = add(unquote_splicing([a, b])); t })
+			};
+			let t = 40;
+			total(t, 2)
+			`,
+			42,
+		},
+		{
+			// an array literal passed to the macro splices in its elements
+			`
+			let sum = fn(a, b, c) { a + b + c };
+			let apply = macro(xs) { quote(sum(unquote_splicing(xs))) };
+			apply([1, 2, 3])
+			`,
+			6,
+		},
+		{
+			`
+			let do = macro(stmts) { quote(if (true) { unquote_splicing(stmts) }) };
+			let x = 1;
+			do([x = x + 1, x * 10])
+			`,
+			20,
+		},
+		{
+			`
+			let wrap = macro(xs) { quote([0, unquote_splicing(xs)]) };
+			len(wrap([1 + 1, 2 + 2]))
+			`,
+			3,
+		},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testExpandAndEval(tt.input), tt.expected)
+	}
+}
+
+func TestUnquoteSplicingQuotedBlock(t *testing.T) {
+	block := testParseProgram("if (true) { x = x + 1; x * 10 }").Statements[0].(*ast.ExpressionStatement).
+		Expression.(*ast.IfExpression).Consequence
+
+	env := object.NewEnvironment()
+	env.Set("x", &object.Integer{Value: 1})
+	env.Set("body", &object.Quote{Node: block})
+
+	quote := Eval(testParseProgram("quote(if (true) { unquote_splicing(body) })"), env)
+	testIntegerObject(t, Eval(quote.(*object.Quote).Node, env), 20)
+}
+
+func TestUnquoteSplicingErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+		expectedPos     token.Position
+	}{
+		{
+			"quote(unquote_splicing([1]) + 1)",
+			"unquote_splicing is only allowed in argument lists, array literals and blocks",
+			token.Position{Offset: 6, Line: 1, Column: 7},
+		},
+		{
+			"quote(f(unquote_splicing(1)))",
+			"argument to `unquote_splicing` must be ARRAY, got INTEGER",
+			token.Position{Offset: 8, Line: 1, Column: 9},
+		},
+		{
+			"quote([unquote_splicing([1], [2])])",
+			"wrong number of arguments. got=2, want=1",
+			token.Position{Offset: 7, Line: 1, Column: 8},
+		},
+		{
+			"quote(f(unquote_splicing([len])))",
+			"cannot unquote BUILTIN, it has no literal form",
+			token.Position{Offset: 8, Line: 1, Column: 9},
+		},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("input %q: no error object returned. got=%T(%+v)",
+				tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q",
+				tt.expectedMessage, errObj.Message)
+		}
+		if errObj.Pos != tt.expectedPos {
+			t.Errorf("input %q: wrong error position. expected=%s, got=%s",
+				tt.input, tt.expectedPos, errObj.Pos)
+		}
+	}
+}
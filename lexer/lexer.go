@@ -1,26 +1,65 @@
 package lexer
 
 import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
 	"github.com/iZarrios/monkey-lang/token"
 )
 
 type Lexer struct {
 	input        string
-	position     int  // current position in input (points to current char)
-	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	position     int  // current byte position in input (points to current char)
+	readPosition int  // current reading byte position in input (after current char)
+	ch           rune // current char under examination
+	line         int  // line of the current char (1-based)
+	column       int  // column of the current char in runes (1-based)
+	offset       int  // byte offset of input in the whole source
+
+	errors []*Error
+}
+
+// Error is a problem found while scanning the input, the offending text is
+// returned as an ILLEGAL token
+type Error struct {
+	Pos     token.Position
+	End     token.Position
+	Message string
+}
+
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Message
 }
 
 func NewLexer(input string) *Lexer {
-	l := &Lexer{input: input}
+	return NewLexerAt(input, 1, 0)
+}
+
+// NewLexerAt lexes input as the part of a larger source that starts at the
+// beginning of line, offset bytes in. The REPL reads one line at a time and
+// uses it to give each line positions of its own.
+func NewLexerAt(input string, line, offset int) *Lexer {
+	l := &Lexer{input: input, line: line, offset: offset}
 	l.readChar()
 	return l
 }
 
 func (l *Lexer) NextToken() token.Token {
+	leading := l.skipWhitespace()
+
+	tok := l.readToken()
+	tok.Leading = leading
+	tok.Trailing = l.readTrailingComments()
+
+	return tok
+}
+
+func (l *Lexer) readToken() token.Token {
 	var tok token.Token
 
-	l.skipWhitespace()
+	pos := l.pos()
 
 	switch l.ch {
 	case '=':
@@ -33,9 +72,23 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(token.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.PLUS_ASSIGN, Literal: literal}
+		} else {
+			tok = newToken(token.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(token.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.MINUS_ASSIGN, Literal: literal}
+		} else {
+			tok = newToken(token.MINUS, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
 			ch := l.ch
@@ -46,13 +99,80 @@ func (l *Lexer) NextToken() token.Token {
 			tok = newToken(token.BANG, l.ch)
 		}
 	case '/':
-		tok = newToken(token.SLASH, l.ch)
+		if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.SLASH_ASSIGN, Literal: literal}
+		} else {
+			tok = newToken(token.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(token.ASTERISK, l.ch)
+		if l.peekChar() == '*' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.POWER, Literal: literal}
+		} else if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.ASTERISK_ASSIGN, Literal: literal}
+		} else {
+			tok = newToken(token.ASTERISK, l.ch)
+		}
+	case '%':
+		tok = newToken(token.PERCENT, l.ch)
+	case '^':
+		tok = newToken(token.CARET, l.ch)
+	case '~':
+		tok = newToken(token.TILDE, l.ch)
 	case '<':
-		tok = newToken(token.LT, l.ch)
+		if l.peekChar() == '<' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.LSHIFT, Literal: literal}
+		} else if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.LE, Literal: literal}
+		} else {
+			tok = newToken(token.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(token.GT, l.ch)
+		if l.peekChar() == '>' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.RSHIFT, Literal: literal}
+		} else if l.peekChar() == '=' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.GE, Literal: literal}
+		} else {
+			tok = newToken(token.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.AND, Literal: literal}
+		} else {
+			tok = newToken(token.AMPERSAND, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			ch := l.ch
+			l.readChar()
+			literal := string(ch) + string(l.ch)
+			tok = token.Token{Type: token.OR, Literal: literal}
+		} else {
+			tok = newToken(token.PIPE, l.ch)
+		}
 	case ';':
 		tok = newToken(token.SEMICOLON, l.ch)
 	case ',':
@@ -68,8 +188,17 @@ func (l *Lexer) NextToken() token.Token {
 	case ')':
 		tok = newToken(token.RPAREN, l.ch)
 	case '"':
-		tok.Type = token.STRING
-		tok.Literal = l.readString()
+		if literal, ok := l.readString(); ok {
+			tok.Type = token.STRING
+			tok.Literal = literal
+		} else {
+			end := l.position
+			if l.ch == '"' {
+				end += 1
+			}
+			tok.Type = token.ILLEGAL
+			tok.Literal = l.input[pos.Offset-l.offset : end]
+		}
 	case '[':
 		tok = newToken(token.LBRACKET, l.ch)
 	case ']':
@@ -81,10 +210,11 @@ func (l *Lexer) NextToken() token.Token {
 		if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = token.LookupIdent(tok.Literal)
+			tok.Pos, tok.End = pos, l.pos()
 			return tok
-		} else if isDigit(l.ch) {
-			tok.Type = token.INT
-			tok.Literal = l.readNumber()
+		} else if isDigit(l.ch) || l.ch == '.' && isDigit(l.peekChar()) {
+			tok.Type, tok.Literal = l.readNumber()
+			tok.Pos, tok.End = pos, l.pos()
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, l.ch)
@@ -92,68 +222,385 @@ func (l *Lexer) NextToken() token.Token {
 	}
 
 	l.readChar()
+	tok.Pos, tok.End = pos, l.pos()
 	return tok
 }
 
-func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
-		l.readChar()
+// Errors returns every error found so far
+func (l *Lexer) Errors() []*Error {
+	return l.errors
+}
+
+func (l *Lexer) errorf(pos, end token.Position, format string, a ...interface{}) {
+	l.errors = append(l.errors, &Error{Pos: pos, End: end, Message: fmt.Sprintf(format, a...)})
+}
+
+// skipWhitespace skips whitespace and comments, returning the comments
+func (l *Lexer) skipWhitespace() []token.Trivia {
+	var comments []token.Trivia
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.isCommentStart():
+			comments = append(comments, l.readComment())
+		default:
+			return comments
+		}
+	}
+}
+
+// readTrailingComments reads the comments following a token on the same line
+func (l *Lexer) readTrailingComments() []token.Trivia {
+	var comments []token.Trivia
+	for {
+		for l.ch == ' ' || l.ch == '\t' {
+			l.readChar()
+		}
+		if !l.isCommentStart() {
+			return comments
+		}
+		comment := l.readComment()
+		comments = append(comments, comment)
+		if comment.Kind == token.LineComment {
+			return comments
+		}
+	}
+}
+
+func (l *Lexer) isCommentStart() bool {
+	return l.ch == '/' && (l.peekChar() == '/' || l.peekChar() == '*')
+}
+
+// readComment reads the comment starting at the current char. Block comments
+// nest, so commenting out code that contains a comment just works.
+func (l *Lexer) readComment() token.Trivia {
+	start := l.pos()
+
+	if l.peekChar() == '/' {
+		for l.ch != '\n' && !l.atEOF() {
+			l.readChar()
+		}
+		return token.Trivia{
+			Kind: token.LineComment,
+			Text: l.input[start.Offset-l.offset : l.position],
+			Pos:  start,
+			End:  l.pos(),
+		}
+	}
+
+	l.readChar()
+	l.readChar()
+	depth := 1
+	for depth > 0 {
+		switch {
+		case l.atEOF():
+			l.errorf(start, l.pos(), "unterminated block comment")
+			depth = 0
+		case l.ch == '/' && l.peekChar() == '*':
+			depth += 1
+			l.readChar()
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth -= 1
+			l.readChar()
+			l.readChar()
+		default:
+			l.readChar()
+		}
+	}
+	return token.Trivia{
+		Kind: token.BlockComment,
+		Text: l.input[start.Offset-l.offset : l.position],
+		Pos:  start,
+		End:  l.pos(),
 	}
 }
 
 func (l *Lexer) readChar() {
+	if l.readPosition > len(l.input) {
+		// already past the end of input, stay on EOF
+		return
+	}
+	if l.ch == '\n' {
+		l.line += 1
+		l.column = 0
+	}
+	l.position = l.readPosition
 	if l.readPosition >= len(l.input) {
 		l.ch = 0
+		l.readPosition += 1
 	} else {
-		l.ch = l.input[l.readPosition]
+		// invalid UTF-8 decodes to utf8.RuneError with a width of 1, which
+		// ends up as an ILLEGAL token
+		ch, width := utf8.DecodeRuneInString(l.input[l.readPosition:])
+		l.ch = ch
+		l.readPosition += width
 	}
-	l.position = l.readPosition
-	l.readPosition += 1
+	l.column += 1
+}
+
+// pos returns the position of the current char
+func (l *Lexer) pos() token.Position {
+	return token.Position{Offset: l.offset + l.position, Line: l.line, Column: l.column}
+}
+
+// nextPos returns the position right after the current char
+func (l *Lexer) nextPos() token.Position {
+	return token.Position{Offset: l.offset + l.readPosition, Line: l.line, Column: l.column + 1}
+}
+
+func (l *Lexer) atEOF() bool {
+	return l.position >= len(l.input)
 }
 
-func (l *Lexer) peekChar() byte {
+func (l *Lexer) peekChar() rune {
 	if l.readPosition >= len(l.input) {
 		return 0
 	} else {
-		return l.input[l.readPosition]
+		ch, _ := utf8.DecodeRuneInString(l.input[l.readPosition:])
+		return ch
 	}
 }
 
+// readIdentifier reads a name that starts with a letter and goes on with
+// letters or digits, so x1 is one identifier. A digit can't start one: 3c is
+// the number 3 followed by c.
 func (l *Lexer) readIdentifier() string {
 	position := l.position
-	for isLetter(l.ch) {
+	for isLetter(l.ch) || isDigit(l.ch) {
 		l.readChar()
 	}
 	return l.input[position:l.position]
 }
 
-func (l *Lexer) readNumber() string {
+// readNumber reads an integer or a float with an optional fraction and
+// exponent, e.g. 42, 1_000, 3.14, .5 or 1e-9. Integers may also be written in
+// hex, octal or binary: 0xFF, 0o755, 0b1010.
+func (l *Lexer) readNumber() (token.TokenType, string) {
+	if l.ch == '0' && strings.ContainsRune("xXoObB", l.peekChar()) {
+		return l.readPrefixedInteger()
+	}
+
 	position := l.position
-	for isDigit(l.ch) {
+	start := l.pos()
+	tokenType := token.TokenType(token.INT)
+
+	ok := l.readDigits(isDigit)
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = token.FLOAT
 		l.readChar()
+		ok = l.readDigits(isDigit) && ok
 	}
-	return l.input[position:l.position]
+
+	if (l.ch == 'e' || l.ch == 'E') && l.isExponent() {
+		tokenType = token.FLOAT
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		ok = l.readDigits(isDigit) && ok
+	}
+
+	literal := l.input[position:l.position]
+	if !ok {
+		l.errorf(start, l.pos(), "invalid number %s, '_' must separate successive digits", literal)
+		return token.ILLEGAL, literal
+	}
+	return tokenType, literal
+}
+
+// readPrefixedInteger reads a 0x, 0o or 0b integer
+func (l *Lexer) readPrefixedInteger() (token.TokenType, string) {
+	position := l.position
+	start := l.pos()
+
+	l.readChar()
+	prefix := unicode.ToLower(l.ch)
+	l.readChar()
+
+	name, base := "hexadecimal", 16
+	switch prefix {
+	case 'o':
+		name, base = "octal", 8
+	case 'b':
+		name, base = "binary", 2
+	}
+
+	// Read all the digits and complain about the ones that don't fit the
+	// base, so 0b102 is one bad literal rather than 0b10 followed by 2
+	isValid := isDigit
+	if base == 16 {
+		isValid = isHexDigit
+	}
+	digitsStart := l.position
+	ok := l.readDigits(isValid)
+
+	literal := l.input[position:l.position]
+	digits := strings.ReplaceAll(l.input[digitsStart:l.position], "_", "")
+
+	switch {
+	case digits == "":
+		l.errorf(start, l.pos(), "invalid number %s, %s literal has no digits", literal, name)
+		return token.ILLEGAL, literal
+	case !ok:
+		l.errorf(start, l.pos(), "invalid number %s, '_' must separate successive digits", literal)
+		return token.ILLEGAL, literal
+	}
+	for _, d := range digits {
+		if hexValue(d) >= base {
+			l.errorf(start, l.pos(), "invalid number %s, %q is not a valid %s digit", literal, d, name)
+			return token.ILLEGAL, literal
+		}
+	}
+	return token.INT, literal
+}
+
+// readDigits reads a run of digits accepted by isValid. Digits may be
+// separated by single underscores, it reports false if an underscore is
+// doubled or ends the run.
+func (l *Lexer) readDigits(isValid func(rune) bool) bool {
+	ok, underscore := true, false
+	for isValid(l.ch) || l.ch == '_' {
+		if l.ch == '_' && underscore {
+			ok = false
+		}
+		underscore = l.ch == '_'
+		l.readChar()
+	}
+	return ok && !underscore
+}
+
+// isExponent reports whether the 'e' under examination starts an exponent,
+// that is it is followed by digits with an optional sign
+func (l *Lexer) isExponent() bool {
+	rest := l.input[l.readPosition:]
+	if len(rest) > 0 && (rest[0] == '+' || rest[0] == '-') {
+		rest = rest[1:]
+	}
+	return len(rest) > 0 && isDigit(rune(rest[0]))
 }
 
-func (l *Lexer) readString() string {
-	position := l.position + 1
+// readString reads the string literal starting at the current '"' and returns
+// its value with escape sequences decoded. It reports false if the literal is
+// unterminated or contains an invalid escape sequence.
+func (l *Lexer) readString() (string, bool) {
+	start := l.pos()
+	valid := true
+
+	var out strings.Builder
 	for {
 		l.readChar()
-		if l.ch == '"' || l.ch == 0 {
-			break
+		switch {
+		case l.ch == '"':
+			return out.String(), valid
+		case l.atEOF():
+			l.errorf(start, l.pos(), "unterminated string literal")
+			return "", false
+		case l.ch == '\\':
+			if ch, ok := l.readEscape(); ok {
+				out.WriteRune(ch)
+			} else {
+				valid = false
+			}
+		default:
+			out.WriteRune(l.ch)
 		}
 	}
-	return l.input[position:l.position]
 }
 
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// readEscape decodes the escape sequence starting at the current backslash and
+// leaves the lexer on its last char
+func (l *Lexer) readEscape() (rune, bool) {
+	start := l.pos()
+	l.readChar()
+
+	switch l.ch {
+	case 'n':
+		return '\n', true
+	case 't':
+		return '\t', true
+	case 'r':
+		return '\r', true
+	case '\\':
+		return '\\', true
+	case '"':
+		return '"', true
+	case 'x':
+		value, ok := l.readHexDigits(2, 2)
+		if !ok {
+			l.errorf(start, l.nextPos(), "invalid escape sequence, \\x must be followed by two hex digits")
+			return 0, false
+		}
+		if value > 0x7F {
+			l.errorf(start, l.nextPos(), "invalid escape sequence, \\x%02X is out of range 00-7F", value)
+			return 0, false
+		}
+		return rune(value), true
+	case 'u':
+		if l.peekChar() != '{' {
+			l.errorf(start, l.nextPos(), "invalid escape sequence, \\u must be followed by {")
+			return 0, false
+		}
+		l.readChar()
+		value, ok := l.readHexDigits(1, 6)
+		if !ok || l.peekChar() != '}' {
+			l.errorf(start, l.nextPos(), "invalid escape sequence, \\u{...} must contain 1 to 6 hex digits")
+			return 0, false
+		}
+		l.readChar()
+		if !utf8.ValidRune(rune(value)) {
+			l.errorf(start, l.nextPos(), "invalid escape sequence, \\u{%X} is not a valid character", value)
+			return 0, false
+		}
+		return rune(value), true
+	}
+
+	if l.atEOF() {
+		// reported as an unterminated string
+		return 0, false
+	}
+	l.errorf(start, l.nextPos(), "unknown escape sequence \\%c", l.ch)
+	return 0, false
+}
+
+// readHexDigits reads between min and max hex digits following the current
+// char and returns their value
+func (l *Lexer) readHexDigits(min, max int) (int, bool) {
+	value, n := 0, 0
+	for n < max && isHexDigit(l.peekChar()) {
+		l.readChar()
+		value = value*16 + hexValue(l.ch)
+		n++
+	}
+	return value, n >= min
+}
+
+func isLetter(ch rune) bool {
+	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_' ||
+		ch >= utf8.RuneSelf && unicode.IsLetter(ch)
 }
 
-func isDigit(ch byte) bool {
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-func newToken(tokenType token.TokenType, ch byte) token.Token {
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || 'a' <= ch && ch <= 'f' || 'A' <= ch && ch <= 'F'
+}
+
+func hexValue(ch rune) int {
+	switch {
+	case isDigit(ch):
+		return int(ch - '0')
+	case 'a' <= ch && ch <= 'f':
+		return int(ch-'a') + 10
+	default:
+		return int(ch-'A') + 10
+	}
+}
+
+func newToken(tokenType token.TokenType, ch rune) token.Token {
 	return token.Token{Type: tokenType, Literal: string(ch)}
 }
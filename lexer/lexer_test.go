@@ -15,8 +15,14 @@ let add = fn(x, y) {
 };
 
 let result = add(five, ten);
-!-/*5;
+!-/ *5;
 5 < 10 > 5;
+5 <= 10 >= 5;
+true && false || true;
+a % b ** c & d | e ^ ~f << g >> h;
+x += 1 -= 2 *= 3 /= 4;
+while break continue
+for (k, v in h)
 
 if (5 < 10) {
 	return true;
@@ -84,6 +90,56 @@ if (5 < 10) {
 		{token.GT, ">"},
 		{token.INT, "5"},
 		{token.SEMICOLON, ";"},
+		{token.INT, "5"},
+		{token.LE, "<="},
+		{token.INT, "10"},
+		{token.GE, ">="},
+		{token.INT, "5"},
+		{token.SEMICOLON, ";"},
+		{token.TRUE, "true"},
+		{token.AND, "&&"},
+		{token.FALSE, "false"},
+		{token.OR, "||"},
+		{token.TRUE, "true"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "a"},
+		{token.PERCENT, "%"},
+		{token.IDENT, "b"},
+		{token.POWER, "**"},
+		{token.IDENT, "c"},
+		{token.AMPERSAND, "&"},
+		{token.IDENT, "d"},
+		{token.PIPE, "|"},
+		{token.IDENT, "e"},
+		{token.CARET, "^"},
+		{token.TILDE, "~"},
+		{token.IDENT, "f"},
+		{token.LSHIFT, "<<"},
+		{token.IDENT, "g"},
+		{token.RSHIFT, ">>"},
+		{token.IDENT, "h"},
+		{token.SEMICOLON, ";"},
+		{token.IDENT, "x"},
+		{token.PLUS_ASSIGN, "+="},
+		{token.INT, "1"},
+		{token.MINUS_ASSIGN, "-="},
+		{token.INT, "2"},
+		{token.ASTERISK_ASSIGN, "*="},
+		{token.INT, "3"},
+		{token.SLASH_ASSIGN, "/="},
+		{token.INT, "4"},
+		{token.SEMICOLON, ";"},
+		{token.WHILE, "while"},
+		{token.BREAK, "break"},
+		{token.CONTINUE, "continue"},
+		{token.FOR, "for"},
+		{token.LPAREN, "("},
+		{token.IDENT, "k"},
+		{token.COMMA, ","},
+		{token.IDENT, "v"},
+		{token.IN, "in"},
+		{token.IDENT, "h"},
+		{token.RPAREN, ")"},
 		{token.IF, "if"},
 		{token.LPAREN, "("},
 		{token.INT, "5"},
@@ -141,3 +197,434 @@ if (5 < 10) {
 		}
 	}
 }
+
+func TestNumbers(t *testing.T) {
+	input := `3.14 .5 1e-9 2E+3 7e2 10 1.5e3 4. 1e x.5`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.FLOAT, "3.14"},
+		{token.FLOAT, ".5"},
+		{token.FLOAT, "1e-9"},
+		{token.FLOAT, "2E+3"},
+		{token.FLOAT, "7e2"},
+		{token.INT, "10"},
+		{token.FLOAT, "1.5e3"},
+		{token.INT, "4"},
+		{token.ILLEGAL, "."},
+		{token.INT, "1"},
+		{token.IDENT, "e"},
+		{token.IDENT, "x"},
+		{token.FLOAT, ".5"},
+		{token.EOF, ""},
+	}
+
+	l := NewLexer(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestNextTokenPositions(t *testing.T) {
+	input := `let x = 5;
+  "ab" == x
+`
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+		expectedEnd  token.Position
+	}{
+		{token.LET, token.Position{Offset: 0, Line: 1, Column: 1}, token.Position{Offset: 3, Line: 1, Column: 4}},
+		{token.IDENT, token.Position{Offset: 4, Line: 1, Column: 5}, token.Position{Offset: 5, Line: 1, Column: 6}},
+		{token.ASSIGN, token.Position{Offset: 6, Line: 1, Column: 7}, token.Position{Offset: 7, Line: 1, Column: 8}},
+		{token.INT, token.Position{Offset: 8, Line: 1, Column: 9}, token.Position{Offset: 9, Line: 1, Column: 10}},
+		{token.SEMICOLON, token.Position{Offset: 9, Line: 1, Column: 10}, token.Position{Offset: 10, Line: 1, Column: 11}},
+		{token.STRING, token.Position{Offset: 13, Line: 2, Column: 3}, token.Position{Offset: 17, Line: 2, Column: 7}},
+		{token.EQ, token.Position{Offset: 18, Line: 2, Column: 8}, token.Position{Offset: 20, Line: 2, Column: 10}},
+		{token.IDENT, token.Position{Offset: 21, Line: 2, Column: 11}, token.Position{Offset: 22, Line: 2, Column: 12}},
+		{token.EOF, token.Position{Offset: 23, Line: 3, Column: 1}, token.Position{Offset: 23, Line: 3, Column: 1}},
+		{token.EOF, token.Position{Offset: 23, Line: 3, Column: 1}, token.Position{Offset: 23, Line: 3, Column: 1}},
+	}
+
+	l := NewLexer(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - pos wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+
+		if tok.End != tt.expectedEnd {
+			t.Fatalf("tests[%d] - end wrong. expected=%+v, got=%+v",
+				i, tt.expectedEnd, tok.End)
+		}
+	}
+}
+
+func TestNextTokenPositionsAt(t *testing.T) {
+	input := "let x =\n \"a"
+
+	tests := []struct {
+		expectedType token.TokenType
+		expectedPos  token.Position
+	}{
+		{token.LET, token.Position{Offset: 20, Line: 3, Column: 1}},
+		{token.IDENT, token.Position{Offset: 24, Line: 3, Column: 5}},
+		{token.ASSIGN, token.Position{Offset: 26, Line: 3, Column: 7}},
+		{token.ILLEGAL, token.Position{Offset: 29, Line: 4, Column: 2}},
+		{token.EOF, token.Position{Offset: 31, Line: 4, Column: 4}},
+	}
+
+	l := NewLexerAt(input, 3, 20)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - pos wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+	}
+	if tok := NewLexerAt(`"ab`, 2, 10).NextToken(); tok.Literal != `"ab` {
+		t.Errorf("literal of unterminated string wrong. got=%q", tok.Literal)
+	}
+}
+
+func TestNextTokenUnicode(t *testing.T) {
+	input := `let café = "héllo wörld";
+名前 + café`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedPos     token.Position
+	}{
+		{token.LET, "let", token.Position{Offset: 0, Line: 1, Column: 1}},
+		{token.IDENT, "café", token.Position{Offset: 4, Line: 1, Column: 5}},
+		{token.ASSIGN, "=", token.Position{Offset: 10, Line: 1, Column: 10}},
+		{token.STRING, "héllo wörld", token.Position{Offset: 12, Line: 1, Column: 12}},
+		{token.SEMICOLON, ";", token.Position{Offset: 27, Line: 1, Column: 25}},
+		{token.IDENT, "名前", token.Position{Offset: 29, Line: 2, Column: 1}},
+		{token.PLUS, "+", token.Position{Offset: 36, Line: 2, Column: 4}},
+		{token.IDENT, "café", token.Position{Offset: 38, Line: 2, Column: 6}},
+		{token.EOF, "", token.Position{Offset: 43, Line: 2, Column: 10}},
+	}
+
+	l := NewLexer(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - pos wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestIdentifiersWithDigits(t *testing.T) {
+	input := `x1 + macroexpand1(a2b) 3c 0x1f2g`
+
+	tests := []struct {
+		expectedType    token.TokenType
+		expectedLiteral string
+	}{
+		{token.IDENT, "x1"},
+		{token.PLUS, "+"},
+		{token.IDENT, "macroexpand1"},
+		{token.LPAREN, "("},
+		{token.IDENT, "a2b"},
+		{token.RPAREN, ")"},
+		// digits only continue an identifier, a number ends where the
+		// letters start
+		{token.INT, "3"},
+		{token.IDENT, "c"},
+		{token.INT, "0x1f2"},
+		{token.IDENT, "g"},
+		{token.EOF, ""},
+	}
+
+	l := NewLexer(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`"a\nb"`, "a\nb"},
+		{`"a\tb\rc"`, "a\tb\rc"},
+		{`"back\\slash"`, `back\slash`},
+		{`"say \"hi\""`, `say "hi"`},
+		{`"\x41\x7e"`, "A~"},
+		{`"\u{e9}t\u{E9}"`, "été"},
+		{`"\u{1F600}"`, "\U0001F600"},
+		{`"ünïcode"`, "ünïcode"},
+	}
+
+	for _, tt := range tests {
+		l := NewLexer(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.STRING {
+			t.Fatalf("input %s: tokentype wrong. expected=%q, got=%q (errors: %v)",
+				tt.input, token.STRING, tok.Type, l.Errors())
+		}
+		if tok.Literal != tt.expected {
+			t.Errorf("input %s: literal wrong. expected=%q, got=%q",
+				tt.input, tt.expected, tok.Literal)
+		}
+		if len(l.Errors()) != 0 {
+			t.Errorf("input %s: unexpected errors %v", tt.input, l.Errors())
+		}
+	}
+}
+
+func TestStringErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedLiteral string
+		expectedErrors  []string
+	}{
+		{
+			`"abc`,
+			`"abc`,
+			[]string{"1:1: unterminated string literal"},
+		},
+		{
+			`"abc\`,
+			`"abc\`,
+			[]string{"1:1: unterminated string literal"},
+		},
+		{
+			`"a\qb"`,
+			`"a\qb"`,
+			[]string{`1:3: unknown escape sequence \q`},
+		},
+		{
+			`"\x4" "\xff"`,
+			`"\x4"`,
+			[]string{`1:2: invalid escape sequence, \x must be followed by two hex digits`},
+		},
+		{
+			`"\xff\u{D800}\u12"`,
+			`"\xff\u{D800}\u12"`,
+			[]string{
+				`1:2: invalid escape sequence, \xFF is out of range 00-7F`,
+				`1:6: invalid escape sequence, \u{D800} is not a valid character`,
+				`1:14: invalid escape sequence, \u must be followed by {`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := NewLexer(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != token.ILLEGAL {
+			t.Fatalf("input %s: tokentype wrong. expected=%q, got=%q",
+				tt.input, token.ILLEGAL, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("input %s: literal wrong. expected=%q, got=%q",
+				tt.input, tt.expectedLiteral, tok.Literal)
+		}
+
+		errors := l.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Fatalf("input %s: wrong number of errors. expected=%d, got=%d (%v)",
+				tt.input, len(tt.expectedErrors), len(errors), errors)
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i].Error() != msg {
+				t.Errorf("input %s: errors[%d] wrong. expected=%q, got=%q",
+					tt.input, i, msg, errors[i].Error())
+			}
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	input := `// leading
+let x = 5; // trailing
+/* block /* nested */ still comment */ x /* one */ /* two */
+// at the end`
+
+	tests := []struct {
+		expectedType     token.TokenType
+		expectedLeading  []string
+		expectedTrailing []string
+	}{
+		{token.LET, []string{"// leading"}, nil},
+		{token.IDENT, nil, nil},
+		{token.ASSIGN, nil, nil},
+		{token.INT, nil, nil},
+		{token.SEMICOLON, nil, []string{"// trailing"}},
+		{token.IDENT, []string{"/* block /* nested */ still comment */"}, []string{"/* one */", "/* two */"}},
+		{token.EOF, []string{"// at the end"}, nil},
+	}
+
+	l := NewLexer(input)
+
+	for i, tt := range tests {
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		testTrivia(t, i, "leading", tok.Leading, tt.expectedLeading)
+		testTrivia(t, i, "trailing", tok.Trailing, tt.expectedTrailing)
+	}
+
+	if len(l.Errors()) != 0 {
+		t.Errorf("unexpected errors %v", l.Errors())
+	}
+}
+
+func testTrivia(t *testing.T, i int, kind string, trivia []token.Trivia, expected []string) {
+	if len(trivia) != len(expected) {
+		t.Fatalf("tests[%d] - wrong number of %s comments. expected=%d, got=%d (%+v)",
+			i, kind, len(expected), len(trivia), trivia)
+	}
+	for j, text := range expected {
+		if trivia[j].Text != text {
+			t.Errorf("tests[%d] - %s comment %d wrong. expected=%q, got=%q",
+				i, kind, j, text, trivia[j].Text)
+		}
+	}
+}
+
+func TestCommentPositions(t *testing.T) {
+	input := "x /* a\nb */ y"
+
+	l := NewLexer(input)
+	l.NextToken()
+	tok := l.NextToken()
+
+	if len(tok.Leading) != 0 || len(l.Errors()) != 0 {
+		t.Fatalf("comment should trail x. leading=%+v, errors=%v", tok.Leading, l.Errors())
+	}
+	if tok.Pos != (token.Position{Offset: 12, Line: 2, Column: 6}) {
+		t.Errorf("y has wrong position. got=%+v", tok.Pos)
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	l := NewLexer("x /* a /* b */")
+	l.NextToken()
+	tok := l.NextToken()
+
+	if tok.Type != token.EOF {
+		t.Fatalf("tokentype wrong. expected=%q, got=%q", token.EOF, tok.Type)
+	}
+
+	errors := l.Errors()
+	if len(errors) != 1 || errors[0].Error() != "1:3: unterminated block comment" {
+		t.Fatalf("wrong errors. got=%v", errors)
+	}
+}
+
+func TestIntegerLiterals(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedType    token.TokenType
+		expectedLiteral string
+		expectedError   string
+	}{
+		{"0xFF", token.INT, "0xFF", ""},
+		{"0Xdead_beef", token.INT, "0Xdead_beef", ""},
+		{"0o755", token.INT, "0o755", ""},
+		{"0b1010", token.INT, "0b1010", ""},
+		{"0b_1010_1010", token.INT, "0b_1010_1010", ""},
+		{"1_000_000", token.INT, "1_000_000", ""},
+		{"1_000.000_1", token.FLOAT, "1_000.000_1", ""},
+		{"0x", token.ILLEGAL, "0x", "1:1: invalid number 0x, hexadecimal literal has no digits"},
+		{"0b_", token.ILLEGAL, "0b_", "1:1: invalid number 0b_, binary literal has no digits"},
+		{"1__0", token.ILLEGAL, "1__0", "1:1: invalid number 1__0, '_' must separate successive digits"},
+		{"1_", token.ILLEGAL, "1_", "1:1: invalid number 1_, '_' must separate successive digits"},
+		{"1_.5", token.ILLEGAL, "1_.5", "1:1: invalid number 1_.5, '_' must separate successive digits"},
+		{"0b102", token.ILLEGAL, "0b102", "1:1: invalid number 0b102, '2' is not a valid binary digit"},
+		{"0o78", token.ILLEGAL, "0o78", "1:1: invalid number 0o78, '8' is not a valid octal digit"},
+	}
+
+	for _, tt := range tests {
+		l := NewLexer(tt.input)
+		tok := l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Errorf("input %s: tokentype wrong. expected=%q, got=%q",
+				tt.input, tt.expectedType, tok.Type)
+		}
+		if tok.Literal != tt.expectedLiteral {
+			t.Errorf("input %s: literal wrong. expected=%q, got=%q",
+				tt.input, tt.expectedLiteral, tok.Literal)
+		}
+		if next := l.NextToken(); next.Type != token.EOF {
+			t.Errorf("input %s: trailing token %q", tt.input, next.Literal)
+		}
+
+		errors := l.Errors()
+		if tt.expectedError == "" {
+			if len(errors) != 0 {
+				t.Errorf("input %s: unexpected errors %v", tt.input, errors)
+			}
+			continue
+		}
+		if len(errors) != 1 || errors[0].Error() != tt.expectedError {
+			t.Errorf("input %s: wrong errors. expected=%q, got=%v",
+				tt.input, tt.expectedError, errors)
+		}
+	}
+}
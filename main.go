@@ -1,11 +1,28 @@
 package main
 
 import (
+	"fmt"
 	"os"
 
 	"github.com/iZarrios/monkey-lang/repl"
 )
 
 func main() {
-	repl.Start(os.Stdin, os.Stdout)
+	switch {
+	case len(os.Args) == 1:
+		repl.Start(os.Stdin, os.Stdout)
+	case len(os.Args) == 2:
+		if err := repl.RunFile(os.Args[1], os.Stderr); err != nil {
+			os.Exit(1)
+		}
+	case len(os.Args) == 3 && os.Args[1] == "expand":
+		if err := repl.ExpandFile(os.Args[2], os.Stdout, os.Stderr); err != nil {
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "usage: %s [file]\n       %s expand file\n\n"+
+			"expand prints file with its macros expanded, for reading only: the names\n"+
+			"macros rename for hygiene, like tmp#3, don't parse\n", os.Args[0], os.Args[0])
+		os.Exit(2)
+	}
 }
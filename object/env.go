@@ -12,8 +12,9 @@ func NewEnvironment() *Environment {
 }
 
 type Environment struct {
-	store map[string]Object
-	outer *Environment
+	store  map[string]Object
+	outer  *Environment
+	macros *Environment
 }
 
 func (e *Environment) Get(name string) (Object, bool) {
@@ -24,7 +25,48 @@ func (e *Environment) Get(name string) (Object, bool) {
 	return obj, ok
 }
 
+// Assign updates the binding for name in the nearest scope that has one. It
+// reports false, and changes nothing, if name isn't bound anywhere.
+func (e *Environment) Assign(name string, val Object) bool {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			env.store[name] = val
+			return true
+		}
+	}
+	return false
+}
+
+// BoundLocally reports whether name is bound in e or a scope around it other
+// than the outermost one, the globals
+func (e *Environment) BoundLocally(name string) bool {
+	for env := e; env.outer != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *Environment) Set(name string, val Object) Object {
 	e.store[name] = val
 	return val
 }
+
+// SetMacros makes macros the environment macroexpand finds macros in, for e
+// and every scope enclosed by it. The macros stay out of the scope chain, so
+// code can't shadow or assign over them.
+func (e *Environment) SetMacros(macros *Environment) {
+	e.macros = macros
+}
+
+// Macros returns the macros set on e or the nearest scope around it, nil if
+// there are none.
+func (e *Environment) Macros() *Environment {
+	for env := e; env != nil; env = env.outer {
+		if env.macros != nil {
+			return env.macros
+		}
+	}
+	return nil
+}
@@ -1,6 +1,9 @@
 package object
 
-import "testing"
+import (
+	"math"
+	"testing"
+)
 
 func TestStringHashKey(t *testing.T) {
 
@@ -31,3 +34,131 @@ func TestStringHashKey(t *testing.T) {
 	}
 
 }
+
+func TestFloatHashKey(t *testing.T) {
+	tests := []struct {
+		float   float64
+		integer int64
+	}{
+		{1, 1},
+		{-3, -3},
+		{0, 0},
+		{math.Copysign(0, -1), 0},
+		{1e18, 1e18},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.float}
+		i := &Integer{Value: tt.integer}
+		if f.HashKey() != i.HashKey() {
+			t.Errorf("float %v and integer %d have different hash keys", tt.float, tt.integer)
+		}
+	}
+
+	half := &Float{Value: 0.5}
+	if half.HashKey() == (&Integer{Value: 0}).HashKey() {
+		t.Errorf("float 0.5 has the hash key of integer 0")
+	}
+	if half.HashKey() != (&Float{Value: 0.5}).HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+	huge := &Float{Value: 1e300}
+	if huge.HashKey() != (&Float{Value: 1e300}).HashKey() {
+		t.Errorf("floats with same value have different hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3, "3.0"},
+		{3.25, "3.25"},
+		{-0.5, "-0.5"},
+		{1e21, "1e+21"},
+		{1e-9, "1e-09"},
+	}
+
+	for _, tt := range tests {
+		f := &Float{Value: tt.value}
+		if f.Inspect() != tt.expected {
+			t.Errorf("Inspect() wrong. expected=%q, got=%q", tt.expected, f.Inspect())
+		}
+	}
+}
+
+func TestEnvironmentAssign(t *testing.T) {
+	outer := NewEnvironment()
+	outer.Set("x", &Integer{Value: 1})
+	inner := NewEnclosedEnvironment(outer)
+
+	if !inner.Assign("x", &Integer{Value: 2}) {
+		t.Fatalf("inner.Assign(x) reported x as unbound")
+	}
+	if _, ok := inner.store["x"]; ok {
+		t.Errorf("inner.Assign(x) created a binding in the inner scope")
+	}
+	if val, _ := outer.Get("x"); val.(*Integer).Value != 2 {
+		t.Errorf("outer x not updated. got=%s", val.Inspect())
+	}
+
+	if inner.Assign("y", &Integer{Value: 3}) {
+		t.Errorf("inner.Assign(y) reported y as bound")
+	}
+	if _, ok := inner.Get("y"); ok {
+		t.Errorf("inner.Assign(y) created a binding")
+	}
+}
+
+func TestEnvironmentBoundLocally(t *testing.T) {
+	global := NewEnvironment()
+	global.Set("g", &Integer{Value: 1})
+	local := NewEnclosedEnvironment(global)
+	local.Set("l", &Integer{Value: 2})
+	inner := NewEnclosedEnvironment(local)
+
+	if !inner.BoundLocally("l") {
+		t.Errorf("inner.BoundLocally(l) reported l as not local")
+	}
+	if inner.BoundLocally("g") {
+		t.Errorf("inner.BoundLocally(g) reported a global as local")
+	}
+	if global.BoundLocally("g") {
+		t.Errorf("global.BoundLocally(g) reported a global as local")
+	}
+}
+
+func TestInspectCycles(t *testing.T) {
+	arr := &Array{Elements: []Object{&Integer{Value: 1}}}
+	arr.Elements = append(arr.Elements, arr)
+	if arr.Inspect() != "[1, [...]]" {
+		t.Errorf("arr.Inspect() wrong. got=%q", arr.Inspect())
+	}
+
+	key := &String{Value: "self"}
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	hash.Pairs[key.HashKey()] = HashPair{Key: key, Value: &Array{Elements: []Object{hash}}}
+	if hash.Inspect() != "{self: [{...}]}" {
+		t.Errorf("hash.Inspect() wrong. got=%q", hash.Inspect())
+	}
+}
+
+func TestHashInspectIsSorted(t *testing.T) {
+	hash := &Hash{Pairs: map[HashKey]HashPair{}}
+	for _, key := range []Object{
+		&String{Value: "b"},
+		&Integer{Value: 10},
+		&String{Value: "a"},
+		&Boolean{Value: true},
+		&Integer{Value: -1},
+		&Boolean{Value: false},
+	} {
+		hash.Pairs[key.(Hashable).HashKey()] = HashPair{Key: key, Value: &Null{}}
+	}
+
+	expected := "{false: null, true: null, -1: null, 10: null, a: null, b: null}"
+	if hash.Inspect() != expected {
+		t.Errorf("hash.Inspect() wrong. want=%q, got=%q", expected, hash.Inspect())
+	}
+}
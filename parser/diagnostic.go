@@ -0,0 +1,93 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/iZarrios/monkey-lang/token"
+)
+
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityError:
+		return "error"
+	case SeverityWarning:
+		return "warning"
+	default:
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+}
+
+// ErrorCode identifies the kind of a diagnostic so tools don't have to match on
+// the message text
+type ErrorCode string
+
+const (
+	ErrUnexpectedToken ErrorCode = "E001" // expectPeek got something else
+	ErrNoPrefixParseFn ErrorCode = "E002" // token can't start an expression
+	ErrInvalidInteger  ErrorCode = "E003" // integer literal out of range
+	ErrLexical         ErrorCode = "E004" // reported by the lexer, e.g. a bad escape
+	ErrInvalidFloat    ErrorCode = "E005" // float literal out of range
+	ErrInvalidAssign   ErrorCode = "E006" // left of = is not a name or index
+	ErrOutsideLoop     ErrorCode = "E007" // break or continue not inside a loop
+)
+
+// Diagnostic is a single problem found while parsing, spanning [Pos, End) in
+// the source
+type Diagnostic struct {
+	Pos      token.Position
+	End      token.Position
+	Severity Severity
+	Code     ErrorCode
+
+	// Only set for ErrUnexpectedToken
+	Expected token.TokenType
+	Got      token.TokenType
+
+	Message string
+}
+
+func (d *Diagnostic) Error() string {
+	return d.Pos.String() + ": " + d.Message
+}
+
+// ErrorList is a list of diagnostics, it implements error so it can be
+// returned as one
+type ErrorList []*Diagnostic
+
+func (l ErrorList) Len() int      { return len(l) }
+func (l ErrorList) Swap(i, j int) { l[i], l[j] = l[j], l[i] }
+func (l ErrorList) Less(i, j int) bool {
+	return l[i].Pos.Offset < l[j].Pos.Offset
+}
+
+// Sort orders the list by source position, keeping the relative order of
+// diagnostics at the same position
+func (l ErrorList) Sort() {
+	sort.Stable(l)
+}
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns nil if the list is empty and the list itself otherwise
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
@@ -0,0 +1,125 @@
+package parser
+
+import (
+	"testing"
+
+	"github.com/iZarrios/monkey-lang/lexer"
+	"github.com/iZarrios/monkey-lang/token"
+)
+
+func TestDiagnostics(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedCode     ErrorCode
+		expectedPos      token.Position
+		expectedEnd      token.Position
+		expectedExpected token.TokenType
+		expectedGot      token.TokenType
+		expectedError    string
+	}{
+		{
+			"let = 5;",
+			ErrUnexpectedToken,
+			token.Position{Offset: 4, Line: 1, Column: 5},
+			token.Position{Offset: 5, Line: 1, Column: 6},
+			token.IDENT,
+			token.ASSIGN,
+			"1:5: expected next token to be IDENT, got = instead",
+		},
+		{
+			"add(1, 2 {",
+			ErrUnexpectedToken,
+			token.Position{Offset: 9, Line: 1, Column: 10},
+			token.Position{Offset: 10, Line: 1, Column: 11},
+			token.RPAREN,
+			token.LBRACE,
+			"1:10: expected next token to be ), got { instead",
+		},
+		{
+			"\n  ;",
+			ErrNoPrefixParseFn,
+			token.Position{Offset: 3, Line: 2, Column: 3},
+			token.Position{Offset: 4, Line: 2, Column: 4},
+			"",
+			"",
+			"2:3: no prefix parse function for ; found",
+		},
+		{
+			"99999999999999999999",
+			ErrInvalidInteger,
+			token.Position{Offset: 0, Line: 1, Column: 1},
+			token.Position{Offset: 20, Line: 1, Column: 21},
+			"",
+			"",
+			`1:1: could not parse "99999999999999999999" as integer`,
+		},
+		{
+			"let s = \"abc;\nlet t = 1;",
+			ErrLexical,
+			token.Position{Offset: 8, Line: 1, Column: 9},
+			token.Position{Offset: 24, Line: 2, Column: 11},
+			"",
+			"",
+			"1:9: unterminated string literal",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p, _ := NewParser(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) == 0 {
+			t.Fatalf("no diagnostics for %q", tt.input)
+		}
+
+		d := errors[0]
+		if d.Severity != SeverityError {
+			t.Errorf("d.Severity not %s. got=%s", SeverityError, d.Severity)
+		}
+		if d.Code != tt.expectedCode {
+			t.Errorf("d.Code not %s. got=%s", tt.expectedCode, d.Code)
+		}
+		if d.Pos != tt.expectedPos {
+			t.Errorf("d.Pos not %+v. got=%+v", tt.expectedPos, d.Pos)
+		}
+		if d.End != tt.expectedEnd {
+			t.Errorf("d.End not %+v. got=%+v", tt.expectedEnd, d.End)
+		}
+		if d.Expected != tt.expectedExpected || d.Got != tt.expectedGot {
+			t.Errorf("d.Expected, d.Got not %q, %q. got=%q, %q",
+				tt.expectedExpected, tt.expectedGot, d.Expected, d.Got)
+		}
+		if d.Error() != tt.expectedError {
+			t.Errorf("d.Error() not %q. got=%q", tt.expectedError, d.Error())
+		}
+	}
+}
+
+func TestErrorList(t *testing.T) {
+	var list ErrorList
+	if list.Err() != nil {
+		t.Fatalf("empty list.Err() not nil. got=%v", list.Err())
+	}
+
+	list = ErrorList{
+		{Pos: token.Position{Offset: 10, Line: 2, Column: 1}, Message: "second"},
+		{Pos: token.Position{Offset: 0, Line: 1, Column: 1}, Message: "first"},
+	}
+	list.Sort()
+
+	if list[0].Message != "first" || list[1].Message != "second" {
+		t.Fatalf("list not sorted by position. got=%q, %q",
+			list[0].Message, list[1].Message)
+	}
+
+	err := list.Err()
+	if err == nil {
+		t.Fatalf("list.Err() is nil")
+	}
+	expected := "1:1: first (and 1 more errors)"
+	if err.Error() != expected {
+		t.Errorf("err.Error() not %q. got=%q", expected, err.Error())
+	}
+}
@@ -10,7 +10,22 @@ import (
 
 type Parser struct {
 	l      *lexer.Lexer
-	errors []string
+	errors ErrorList
+
+	// set when an error is reported, further errors are dropped until the
+	// parser has synchronized on the next statement
+	recovering bool
+
+	// number of lexer errors already turned into diagnostics
+	lexerErrors int
+
+	// number of loops around the current token within the current function,
+	// break and continue are only allowed when it's positive
+	loopDepth int
+
+	// number of '{' before the current token that are still open, used to
+	// find where a broken statement ends
+	braceDepth int
 
 	curToken  token.Token
 	peekToken token.Token
@@ -26,7 +41,7 @@ func NewParser(l *lexer.Lexer) (*Parser, error) {
 
 	p := &Parser{
 		l:              l,
-		errors:         make([]string, 0),
+		errors:         ErrorList{},
 		prefixParseFns: make(map[token.TokenType]prefixParseFn),
 		infixParseFns:  make(map[token.TokenType]infixParseFn),
 	}
@@ -38,13 +53,17 @@ func NewParser(l *lexer.Lexer) (*Parser, error) {
 	{ // PREFIX
 		p.registerPrefix(token.IDENT, p.parseIdentifier)
 		p.registerPrefix(token.INT, p.parseIntegerLiteral)
+		p.registerPrefix(token.FLOAT, p.parseFloatLiteral)
 		p.registerPrefix(token.BANG, p.parsePrefixExpression)
 		p.registerPrefix(token.MINUS, p.parsePrefixExpression)
+		p.registerPrefix(token.TILDE, p.parsePrefixExpression)
 		p.registerPrefix(token.TRUE, p.parseBoolean)
 		p.registerPrefix(token.FALSE, p.parseBoolean)
+		p.registerPrefix(token.NULL, p.parseNullLiteral)
 		p.registerPrefix(token.LPAREN, p.parseGroupedExpression)
 		p.registerPrefix(token.IF, p.parseIfExpression)
 		p.registerPrefix(token.FUNCTION, p.parseFunctionLiteral)
+		p.registerPrefix(token.MACRO, p.parseMacroLiteral)
 		p.registerPrefix(token.STRING, p.parseStringLiteral)
 		p.registerPrefix(token.LBRACKET, p.parseArrayLiteral)
 		p.registerPrefix(token.LBRACE, p.parseHashLiteral)
@@ -56,10 +75,26 @@ func NewParser(l *lexer.Lexer) (*Parser, error) {
 		p.registerInfix(token.MINUS, p.parseInfixExpression)
 		p.registerInfix(token.SLASH, p.parseInfixExpression)
 		p.registerInfix(token.ASTERISK, p.parseInfixExpression)
+		p.registerInfix(token.PERCENT, p.parseInfixExpression)
+		p.registerInfix(token.POWER, p.parseInfixExpression)
+		p.registerInfix(token.AMPERSAND, p.parseInfixExpression)
+		p.registerInfix(token.PIPE, p.parseInfixExpression)
+		p.registerInfix(token.CARET, p.parseInfixExpression)
+		p.registerInfix(token.LSHIFT, p.parseInfixExpression)
+		p.registerInfix(token.RSHIFT, p.parseInfixExpression)
 		p.registerInfix(token.EQ, p.parseInfixExpression)
 		p.registerInfix(token.NOT_EQ, p.parseInfixExpression)
 		p.registerInfix(token.LT, p.parseInfixExpression)
 		p.registerInfix(token.GT, p.parseInfixExpression)
+		p.registerInfix(token.LE, p.parseInfixExpression)
+		p.registerInfix(token.GE, p.parseInfixExpression)
+		p.registerInfix(token.ASSIGN, p.parseAssignExpression)
+		p.registerInfix(token.PLUS_ASSIGN, p.parseAssignExpression)
+		p.registerInfix(token.MINUS_ASSIGN, p.parseAssignExpression)
+		p.registerInfix(token.ASTERISK_ASSIGN, p.parseAssignExpression)
+		p.registerInfix(token.SLASH_ASSIGN, p.parseAssignExpression)
+		p.registerInfix(token.AND, p.parseLogicalExpression)
+		p.registerInfix(token.OR, p.parseLogicalExpression)
 		p.registerInfix(token.LPAREN, p.parseCallExpression)
 		p.registerInfix(token.LBRACKET, p.parseIndexExpression)
 	}
@@ -67,23 +102,79 @@ func NewParser(l *lexer.Lexer) (*Parser, error) {
 	return p, nil
 }
 
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() ErrorList {
 	return p.errors
 }
 
 func (p *Parser) ParseProgram() *ast.Program {
 	program := &ast.Program{}
-	program.Statements = []ast.Statement{}
+	program.Statements = p.parseStatementList(token.EOF)
 
-	for p.curToken.Type != token.EOF {
+	return program
+}
+
+// parseStatementList parses statements up to `end` (or EOF). A statement that
+// fails to parse is dropped and the parser skips ahead to the next one, so
+// every independent error in the input gets reported in one pass.
+func (p *Parser) parseStatementList(end token.TokenType) []ast.Statement {
+	statements := []ast.Statement{}
+	depth := p.braceDepth
+
+	for p.curToken.Type != end && p.curToken.Type != token.EOF {
 		stmt := p.parseStatement()
 
-		program.Statements = append(program.Statements, stmt)
+		if p.recovering {
+			p.synchronize(end, depth)
+			if p.curToken.Type == end {
+				break
+			}
+		} else if stmt != nil {
+			statements = append(statements, stmt)
+		}
 
 		p.nextToken()
 	}
 
-	return program
+	return statements
+}
+
+// synchronize skips the rest of a broken statement in a list that ends with
+// `end` and has depth braces open around it. It stops on the statement's
+// closing ';', before the next statement keyword or on the '}' that closes the
+// enclosing block. Braces the statement opened, even ones a failed
+// expression left open, are skipped along with an unmatched '}' at the top
+// level.
+func (p *Parser) synchronize(end token.TokenType, depth int) {
+	for p.curToken.Type != token.EOF {
+		switch p.curToken.Type {
+		case token.RBRACE:
+			if end == token.RBRACE && p.braceDepth == depth {
+				p.recovering = false
+				return
+			}
+		case token.SEMICOLON:
+			if p.braceDepth == depth {
+				p.recovering = false
+				return
+			}
+		}
+
+		if p.peekBraceDepth() == depth {
+			switch p.peekToken.Type {
+			case token.LET, token.RETURN, token.WHILE, token.FOR:
+				p.recovering = false
+				return
+			case token.RBRACE:
+				if end == token.RBRACE {
+					p.recovering = false
+					return
+				}
+			}
+		}
+
+		p.nextToken()
+	}
+	p.recovering = false
 }
 
 func (p *Parser) parseStatement() ast.Statement {
@@ -92,17 +183,29 @@ func (p *Parser) parseStatement() ast.Statement {
 		return p.parseLetStatement()
 	case token.RETURN:
 		return p.parseReturnStatement()
+	case token.WHILE:
+		return p.parseWhileStatement()
+	case token.FOR:
+		return p.parseForStatement()
+	case token.BREAK, token.CONTINUE:
+		return p.parseLoopControlStatement()
+	case token.FUNCTION:
+		// a nameless fn is a function literal used as an expression
+		if p.peekToken.Type == token.IDENT {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExrepssionStatement()
 	default:
 		return p.parseExrepssionStatement()
 	}
 }
 
-func (p *Parser) parseLetStatement() *ast.LetStatement {
+func (p *Parser) parseLetStatement() ast.Statement {
 	stmt := &ast.LetStatement{Token: p.curToken}
 	if !p.expectPeek(token.IDENT) {
 		return nil
 	}
-	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	stmt.Name = p.parseBindingIdentifier()
 	if !p.expectPeek(token.ASSIGN) {
 		return nil
 	}
@@ -110,6 +213,99 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	p.nextToken()
 
 	stmt.Value = p.parseExpression(LOWEST)
+	if fl, ok := stmt.Value.(*ast.FunctionLiteral); ok && stmt.Name.Unquote == nil {
+		fl.Name = stmt.Name.Value
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	stmt := &ast.FunctionStatement{Token: p.curToken}
+	p.nextToken()
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+
+	stmt.Function = &ast.FunctionLiteral{Token: stmt.Token, Name: stmt.Name.Value}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	stmt.Function.Parameters = p.parseFunctionParameters()
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	stmt.Function.Body = p.parseFunctionBody()
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseWhileStatement() ast.Statement {
+	stmt := &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.loopDepth++
+	stmt.Body = p.parseBlockStatement()
+	p.loopDepth--
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+func (p *Parser) parseForStatement() ast.Statement {
+	stmt := &ast.ForStatement{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	stmt.Value = p.parseBindingIdentifier()
+	if p.peekToken.Type == token.COMMA {
+		p.nextToken()
+		if !p.expectPeek(token.IDENT) {
+			return nil
+		}
+		stmt.Key = stmt.Value
+		stmt.Value = p.parseBindingIdentifier()
+	}
+	if !p.expectPeek(token.IN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	p.loopDepth++
+	stmt.Body = p.parseBlockStatement()
+	p.loopDepth--
 
 	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
@@ -118,21 +314,38 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 	return stmt
 }
 
-func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	tok := p.curToken
+	if p.loopDepth == 0 {
+		p.errorAt(tok, ErrOutsideLoop, "%s outside of a loop", tok.Literal)
+		return nil
+	}
+
+	if p.peekToken.Type == token.SEMICOLON {
+		p.nextToken()
+	}
+
+	if tok.Type == token.BREAK {
+		return &ast.BreakStatement{Token: tok}
+	}
+	return &ast.ContinueStatement{Token: tok}
+}
+
+func (p *Parser) parseReturnStatement() ast.Statement {
 	stmt := &ast.ReturnStatement{Token: p.curToken}
 
 	p.nextToken()
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for p.curToken.Type != token.SEMICOLON {
+	if p.peekToken.Type == token.SEMICOLON {
 		p.nextToken()
 	}
 
 	return stmt
 }
 
-func (p *Parser) parseExrepssionStatement() *ast.ExpressionStatement {
+func (p *Parser) parseExrepssionStatement() ast.Statement {
 	defer untrace(trace("parseExpressionStatement"))
 	stmt := &ast.ExpressionStatement{Token: p.curToken}
 
@@ -156,7 +369,9 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 	}
 	leftExp := prefix()
 
-	for p.peekToken.Type != token.SEMICOLON && precedence < p.peekPrecedence() {
+	// a failed operand is already reported, an operator after it would only
+	// wrap nil and pile up errors about it
+	for leftExp != nil && p.peekToken.Type != token.SEMICOLON && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 		if infix == nil {
 			return leftExp
@@ -191,6 +406,52 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 		Left:     left,
 	}
 
+	precedence := p.curPrecedence()
+	if p.curToken.Type == token.POWER {
+		// right associative, 2 ** 3 ** 2 == 2 ** (3 ** 2)
+		precedence--
+	}
+	p.nextToken()
+	expression.Right = p.parseExpression(precedence)
+
+	return expression
+}
+
+// parseAssignExpression parses the right-hand side one level below ASSIGN so
+// that `a = b = c` groups as `a = (b = c)`
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   target,
+	}
+
+	switch target := target.(type) {
+	case *ast.Identifier, *ast.IndexExpression:
+	case *ast.CallExpression:
+		// in a quoted template, replaced by a name before it is evaluated
+		if target.Function == nil || target.Function.TokenLiteral() != "unquote" {
+			p.errorAt(p.curToken, ErrInvalidAssign, "cannot assign to %s", target)
+			return nil
+		}
+	default:
+		p.errorAt(p.curToken, ErrInvalidAssign, "cannot assign to %s", target)
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
+
+func (p *Parser) parseLogicalExpression(left ast.Expression) ast.Expression {
+	expression := &ast.LogicalExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Left:     left,
+	}
+
 	precedence := p.curPrecedence()
 	p.nextToken()
 	expression.Right = p.parseExpression(precedence)
@@ -233,6 +494,23 @@ func (p *Parser) parseIfExpression() ast.Expression {
 	if p.peekToken.Type == token.ELSE {
 		p.nextToken()
 
+		// `else if` is sugar for an else block holding nothing but the next if
+		if p.peekToken.Type == token.IF {
+			p.nextToken()
+			tok := p.curToken
+			nested := p.parseIfExpression()
+			if nested == nil {
+				return nil
+			}
+			expression.Alternative = &ast.BlockStatement{
+				Token: tok,
+				Statements: []ast.Statement{
+					&ast.ExpressionStatement{Token: tok, Expression: nested},
+				},
+			}
+			return expression
+		}
+
 		if !p.expectPeek(token.LBRACE) {
 			return nil
 		}
@@ -244,18 +522,16 @@ func (p *Parser) parseIfExpression() ast.Expression {
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	block := &ast.BlockStatement{Token: p.curToken}
-	block.Statements = []ast.Statement{}
 
 	p.nextToken()
 
-	for p.curToken.Type != token.RBRACE && p.curToken.Type != token.EOF {
-		stmt := p.parseStatement()
+	block.Statements = p.parseStatementList(token.RBRACE)
 
-		// //TODO: not needed?
-		// if stmt != nil {
-		block.Statements = append(block.Statements, stmt)
-		// }
-		p.nextToken()
+	if p.curToken.Type != token.RBRACE {
+		d := p.errorAt(p.curToken, ErrUnexpectedToken,
+			"expected %s to close block, got %s instead", token.RBRACE, p.curToken.Type)
+		d.Expected = token.RBRACE
+		d.Got = p.curToken.Type
 	}
 	return block
 }
@@ -273,11 +549,39 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	fnLiteral.Body = p.parseBlockStatement()
+	fnLiteral.Body = p.parseFunctionBody()
 
 	return fnLiteral
 }
 
+func (p *Parser) parseMacroLiteral() ast.Expression {
+	macro := &ast.MacroLiteral{Token: p.curToken}
+
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+
+	macro.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+
+	macro.Body = p.parseFunctionBody()
+
+	return macro
+}
+
+// parseFunctionBody parses a block that loops outside of the function can't be
+// broken out of from
+func (p *Parser) parseFunctionBody() *ast.BlockStatement {
+	outer := p.loopDepth
+	p.loopDepth = 0
+	body := p.parseBlockStatement()
+	p.loopDepth = outer
+	return body
+}
+
 func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 
 	idents := []*ast.Identifier{}
@@ -292,22 +596,14 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	p.nextToken()
 
 	// get first param
-	ident := &ast.Identifier{
-		Token: p.curToken,
-		Value: p.curToken.Literal,
-	}
-	idents = append(idents, ident)
+	idents = append(idents, p.parseBindingIdentifier())
 
 	for p.peekToken.Type == token.COMMA {
 		// make current = comma
 		p.nextToken()
 		// make current = ident
 		p.nextToken()
-		ident := &ast.Identifier{
-			Token: p.curToken,
-			Value: p.curToken.Literal,
-		}
-		idents = append(idents, ident)
+		idents = append(idents, p.parseBindingIdentifier())
 	}
 
 	if !p.expectPeek(token.RPAREN) {
@@ -318,6 +614,21 @@ func (p *Parser) parseFunctionParameters() []*ast.Identifier {
 	return idents
 }
 
+// parseBindingIdentifier parses the name a let, a parameter or a for loop
+// binds. As with assignment targets, it may be an unquote(...) call, which a
+// quoted template replaces with a name before it is evaluated.
+func (p *Parser) parseBindingIdentifier() *ast.Identifier {
+	ident := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	if p.curToken.Literal != "unquote" || p.peekToken.Type != token.LPAREN {
+		return ident
+	}
+
+	unquote := &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.nextToken()
+	ident.Unquote, _ = p.parseCallExpression(unquote).(*ast.CallExpression)
+	return ident
+}
+
 // `function` is the left operand
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	callExpr := &ast.CallExpression{
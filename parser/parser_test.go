@@ -6,6 +6,7 @@ import (
 
 	"github.com/iZarrios/monkey-lang/ast"
 	"github.com/iZarrios/monkey-lang/lexer"
+	"github.com/iZarrios/monkey-lang/token"
 )
 
 func checkParserErrors(t *testing.T, p *Parser) {
@@ -155,6 +156,7 @@ func TestParsingPrefixExpressions(t *testing.T) {
 	}{
 		{"!5;", "!", 5},
 		{"-15;", "-", 15},
+		{"~15;", "~", 15},
 		{"!foobar;", "!", "foobar"},
 		{"-foobar;", "-", "foobar"},
 		{"!true;", "!", true},
@@ -226,6 +228,15 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 / 5;", 5, "/", 5},
 		{"5 > 5;", 5, ">", 5},
 		{"5 < 5;", 5, "<", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 ** 5;", 5, "**", 5},
+		{"5 & 5;", 5, "&", 5},
+		{"5 | 5;", 5, "|", 5},
+		{"5 ^ 5;", 5, "^", 5},
+		{"5 << 5;", 5, "<<", 5},
+		{"5 >> 5;", 5, ">>", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
 		{"true == true", true, "==", true},
@@ -311,6 +322,78 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"5 < 4 != 3 > 4",
 			"((5 < 4) != (3 > 4))",
 		},
+		{
+			"a + 1 <= b * 2 == c >= d",
+			"(((a + 1) <= (b * 2)) == (c >= d))",
+		},
+		{
+			"a || b && c",
+			"(a || (b && c))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a == b && c < d || !e",
+			"(((a == b) && (c < d)) || (!e))",
+		},
+		{
+			"a && b && c",
+			"((a && b) && c)",
+		},
+		{
+			"a * b % c",
+			"((a * b) % c)",
+		},
+		{
+			"2 ** 3 ** 2",
+			"(2 ** (3 ** 2))",
+		},
+		{
+			"-2 ** 2",
+			"(-(2 ** 2))",
+		},
+		{
+			"2 ** -1 * 3",
+			"((2 ** (-1)) * 3)",
+		},
+		{
+			"a | b ^ c & d",
+			"(a | (b ^ (c & d)))",
+		},
+		{
+			"x = y = 1 + 2",
+			"(x = (y = (1 + 2)))",
+		},
+		{
+			"a[i + 1] += b || c",
+			"((a[(i + 1)]) += (b || c))",
+		},
+		{
+			"x *= -y",
+			"(x *= (-y))",
+		},
+		{
+			"unquote(a) = b",
+			"(unquote(a) = b)",
+		},
+		{
+			"a & b == c",
+			"((a & b) == c)",
+		},
+		{
+			"1 << 2 + 3",
+			"(1 << (2 + 3))",
+		},
+		{
+			"a < b << c",
+			"(a < (b << c))",
+		},
+		{
+			"~a & b",
+			"((~a) & b)",
+		},
 		{
 			"3 + 4 * 5 == 3 * 1 + 4 * 5",
 			"((3 + (4 * 5)) == ((3 * 1) + (4 * 5)))",
@@ -482,6 +565,32 @@ func TestBooleanExpression(t *testing.T) {
 	}
 }
 
+func TestNullLiteral(t *testing.T) {
+	l := lexer.NewLexer("null;")
+	p, _ := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program has not enough statements. got=%d",
+			len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	null, ok := stmt.Expression.(*ast.NullLiteral)
+	if !ok {
+		t.Fatalf("exp not *ast.NullLiteral. got=%T", stmt.Expression)
+	}
+	if null.TokenLiteral() != "null" {
+		t.Errorf("null.TokenLiteral not %q. got=%q", "null", null.TokenLiteral())
+	}
+}
+
 func testBooleanLiteral(t *testing.T, exp ast.Expression, value bool) bool {
 	bo, ok := exp.(*ast.Boolean)
 	if !ok {
@@ -548,6 +657,148 @@ func TestIfExpression(t *testing.T) {
 	}
 }
 
+func TestElseIfExpression(t *testing.T) {
+	input := `if (x < y) { x } else if (x > y) { y } else if (x == 1) { 1 } else { z }`
+	l := lexer.NewLexer(input)
+	p, _ := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+	exp, ok := stmt.Expression.(*ast.IfExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.IfExpression. got=%T", stmt.Expression)
+	}
+
+	// each else if is the only statement of its parent's alternative
+	conditions := []struct {
+		left     interface{}
+		operator string
+		right    interface{}
+	}{
+		{"x", "<", "y"},
+		{"x", ">", "y"},
+		{"x", "==", 1},
+	}
+	for i, cond := range conditions {
+		if !testInfixExpression(t, exp.Condition, cond.left, cond.operator, cond.right) {
+			return
+		}
+		if i == len(conditions)-1 {
+			break
+		}
+		if exp.Alternative == nil || len(exp.Alternative.Statements) != 1 {
+			t.Fatalf("branch %d: alternative is not a single statement. got=%+v",
+				i, exp.Alternative)
+		}
+		alt, ok := exp.Alternative.Statements[0].(*ast.ExpressionStatement)
+		if !ok {
+			t.Fatalf("branch %d: alternative is not ast.ExpressionStatement. got=%T",
+				i, exp.Alternative.Statements[0])
+		}
+		exp, ok = alt.Expression.(*ast.IfExpression)
+		if !ok {
+			t.Fatalf("branch %d: alternative is not ast.IfExpression. got=%T",
+				i, alt.Expression)
+		}
+	}
+	if exp.Alternative == nil {
+		t.Fatalf("final else is missing")
+	}
+
+	expected := "if(x < y) xelse if(x > y) yelse if(x == 1) 1else z"
+	if stmt.String() != expected {
+		t.Errorf("stmt.String() wrong. want=%q, got=%q", expected, stmt.String())
+	}
+}
+
+func TestWhileStatement(t *testing.T) {
+	input := `while (x < y) { x += 1; if (x == 3) { continue; } break }`
+	l := lexer.NewLexer(input)
+	p, _ := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.WhileStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.WhileStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if !testInfixExpression(t, stmt.Condition, "x", "<", "y") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 3 {
+		t.Fatalf("body is not 3 statements. got=%d\n", len(stmt.Body.Statements))
+	}
+	if _, ok := stmt.Body.Statements[2].(*ast.BreakStatement); !ok {
+		t.Errorf("Statements[2] is not ast.BreakStatement. got=%T",
+			stmt.Body.Statements[2])
+	}
+
+	expected := "while(x < y) (x += 1)if(x == 3) continue;break;"
+	if stmt.String() != expected {
+		t.Errorf("stmt.String() wrong. want=%q, got=%q", expected, stmt.String())
+	}
+}
+
+func TestForStatement(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedKey   string
+		expectedValue string
+		expected      string
+	}{
+		{"for (x in xs) { x }", "", "x", "for(x in xs) x"},
+		{"for (k, v in h) { k; v }", "k", "v", "for(k, v in h) kv"},
+		{"for (i in range(1, 3)) { break }", "", "i", "for(i in range(1, 3)) break;"},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p, _ := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+				1, len(program.Statements))
+		}
+		stmt, ok := program.Statements[0].(*ast.ForStatement)
+		if !ok {
+			t.Fatalf("program.Statements[0] is not ast.ForStatement. got=%T",
+				program.Statements[0])
+		}
+
+		if tt.expectedKey == "" {
+			if stmt.Key != nil {
+				t.Errorf("stmt.Key not nil. got=%s", stmt.Key)
+			}
+		} else {
+			testIdentifier(t, stmt.Key, tt.expectedKey)
+		}
+		testIdentifier(t, stmt.Value, tt.expectedValue)
+
+		if stmt.String() != tt.expected {
+			t.Errorf("stmt.String() wrong. want=%q, got=%q", tt.expected, stmt.String())
+		}
+	}
+}
+
 func TestIfElseExpression(t *testing.T) {
 	input := `if (x < y) { x } else { y }`
 	l := lexer.NewLexer(input)
@@ -639,6 +890,112 @@ func TestFunctionLiteralParsing(t *testing.T) {
 
 	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
 }
+func TestFunctionLiteralWithName(t *testing.T) {
+	input := `let myFunction = fn() { };`
+	l := lexer.NewLexer(input)
+	p, _ := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.LetStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.LetStatement. got=%T",
+			program.Statements[0])
+	}
+
+	function, ok := stmt.Value.(*ast.FunctionLiteral)
+	if !ok {
+		t.Fatalf("stmt.Value is not ast.FunctionLiteral. got=%T", stmt.Value)
+	}
+
+	if function.Name != "myFunction" {
+		t.Fatalf("function literal name wrong. want 'myFunction', got=%q\n",
+			function.Name)
+	}
+}
+
+func TestFunctionStatement(t *testing.T) {
+	input := `fn add(x, y) { x + y; }`
+	l := lexer.NewLexer(input)
+	p, _ := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.FunctionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	if stmt.Name.Value != "add" {
+		t.Errorf("stmt.Name.Value not 'add'. got=%q", stmt.Name.Value)
+	}
+	if stmt.Function.Name != "add" {
+		t.Errorf("stmt.Function.Name not 'add'. got=%q", stmt.Function.Name)
+	}
+	if len(stmt.Function.Parameters) != 2 {
+		t.Fatalf("function parameters wrong. want 2, got=%d\n",
+			len(stmt.Function.Parameters))
+	}
+	testLiteralExpression(t, stmt.Function.Parameters[0], "x")
+	testLiteralExpression(t, stmt.Function.Parameters[1], "y")
+
+	if stmt.String() != "fn add(x, y)(x + y)" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+}
+
+func TestMacroLiteralParsing(t *testing.T) {
+	input := `macro(x, y) { x + y; }`
+
+	l := lexer.NewLexer(input)
+	p, _ := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d\n",
+			1, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("statement is not ast.ExpressionStatement. got=%T",
+			program.Statements[0])
+	}
+
+	macro, ok := stmt.Expression.(*ast.MacroLiteral)
+	if !ok {
+		t.Fatalf("stmt.Expression is not ast.MacroLiteral. got=%T",
+			stmt.Expression)
+	}
+
+	if len(macro.Parameters) != 2 {
+		t.Fatalf("macro literal parameters wrong. want 2, got=%d\n",
+			len(macro.Parameters))
+	}
+
+	testLiteralExpression(t, macro.Parameters[0], "x")
+	testLiteralExpression(t, macro.Parameters[1], "y")
+
+	if len(macro.Body.Statements) != 1 {
+		t.Fatalf("macro.Body.Statements has not 1 statements. got=%d\n",
+			len(macro.Body.Statements))
+	}
+
+	bodyStmt, ok := macro.Body.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("macro body stmt is not ast.ExpressionStatement. got=%T",
+			macro.Body.Statements[0])
+	}
+
+	testInfixExpression(t, bodyStmt.Expression, "x", "+", "y")
+}
+
 func TestFunctionParameterParsing(t *testing.T) {
 	tests := []struct {
 		input          string
@@ -670,6 +1027,54 @@ func TestFunctionParameterParsing(t *testing.T) {
 	}
 }
 
+func TestUnquoteBindingParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+		bindings func(ast.Statement) []*ast.Identifier
+	}{
+		{
+			"let unquote(name) = 1;",
+			"unquote(name)",
+			func(s ast.Statement) []*ast.Identifier {
+				return []*ast.Identifier{s.(*ast.LetStatement).Name}
+			},
+		},
+		{
+			"fn(a, unquote(gensym())) { a };",
+			"unquote(gensym())",
+			func(s ast.Statement) []*ast.Identifier {
+				fn := s.(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+				return fn.Parameters[1:]
+			},
+		},
+		{
+			"for (k, unquote(v) in xs) { k }",
+			"unquote(v)",
+			func(s ast.Statement) []*ast.Identifier {
+				return []*ast.Identifier{s.(*ast.ForStatement).Value}
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p, _ := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		ident := tt.bindings(program.Statements[0])[0]
+		if ident.Unquote == nil {
+			t.Errorf("input %q: binding has no Unquote", tt.input)
+			continue
+		}
+		if ident.String() != tt.expected {
+			t.Errorf("input %q: wrong binding. want=%q, got=%q",
+				tt.input, tt.expected, ident.String())
+		}
+	}
+}
+
 func TestCallExpressionParsing(t *testing.T) {
 	input := "add(1, 2 * 3, 4 + 5);"
 	l := lexer.NewLexer(input)
@@ -725,6 +1130,34 @@ func TestStringLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{".5", 0.5},
+		{"1e-9", 1e-9},
+		{"2.5E3", 2500},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p, _ := NewParser(l)
+		program := p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
 func TestParsingArrayLiterals(t *testing.T) {
 	input := "[1, 2 * 2, 3 + 3]"
 	l := lexer.NewLexer(input)
@@ -853,3 +1286,189 @@ func TestParsingHashLiteralsWithExpressions(t *testing.T) {
 		testFunc(value)
 	}
 }
+
+func TestNodePositions(t *testing.T) {
+	input := `let x = 1;
+x + add(2)`
+	l := lexer.NewLexer(input)
+	p, _ := NewParser(l)
+	program := p.ParseProgram()
+	checkParserErrors(t, p)
+
+	letStmt := program.Statements[0].(*ast.LetStatement)
+	exprStmt := program.Statements[1].(*ast.ExpressionStatement)
+	infix := exprStmt.Expression.(*ast.InfixExpression)
+	call := infix.Right.(*ast.CallExpression)
+
+	tests := []struct {
+		node        ast.Node
+		expectedPos token.Position
+	}{
+		{program, token.Position{Offset: 0, Line: 1, Column: 1}},
+		{letStmt, token.Position{Offset: 0, Line: 1, Column: 1}},
+		{letStmt.Name, token.Position{Offset: 4, Line: 1, Column: 5}},
+		{letStmt.Value, token.Position{Offset: 8, Line: 1, Column: 9}},
+		{exprStmt, token.Position{Offset: 11, Line: 2, Column: 1}},
+		{infix, token.Position{Offset: 13, Line: 2, Column: 3}},
+		{call.Function, token.Position{Offset: 15, Line: 2, Column: 5}},
+		{call, token.Position{Offset: 18, Line: 2, Column: 8}},
+		{call.Arguments[0], token.Position{Offset: 19, Line: 2, Column: 9}},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos() != tt.expectedPos {
+			t.Errorf("tests[%d] - %q pos wrong. expected=%s, got=%s",
+				i, tt.node.String(), tt.expectedPos, tt.node.Pos())
+		}
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input              string
+		expectedErrors     []string
+		expectedStatements string
+	}{
+		{
+			"let = 5; let y 6; let z = 7;",
+			[]string{
+				"1:5: expected next token to be IDENT, got = instead",
+				"1:16: expected next token to be =, got INT instead",
+			},
+			"let z = 7;",
+		},
+		{
+			"add(1, 2 { 3 }; let x = ; x",
+			[]string{
+				"1:10: expected next token to be ), got { instead",
+				"1:25: no prefix parse function for ; found",
+			},
+			"x",
+		},
+		{
+			"let x = 1 let y = 2",
+			[]string{},
+			"let x = 1;let y = 2;",
+		},
+		{
+			"if (x) { let = 1; y } let z = (;",
+			[]string{
+				"1:14: expected next token to be IDENT, got = instead",
+				"1:32: no prefix parse function for ; found",
+			},
+			"ifx y",
+		},
+		{
+			"fn(x) { x",
+			[]string{
+				"1:10: expected } to close block, got EOF instead",
+			},
+			"",
+		},
+		{
+			"return 5",
+			[]string{},
+			"return 5;",
+		},
+		{
+			"break; while (x) { fn() { continue } }; x",
+			[]string{
+				"1:1: break outside of a loop",
+				"1:27: continue outside of a loop",
+			},
+			"whilex fn()x",
+		},
+		{
+			"if (x) { 1 } else if { 2 }; y",
+			[]string{
+				"1:22: expected next token to be (, got { instead",
+			},
+			"y",
+		},
+		{
+			"1 + 2 = 3; x = 4",
+			[]string{
+				"1:7: cannot assign to (1 + 2)",
+			},
+			"(x = 4)",
+		},
+		{
+			"f(a) = 1; x",
+			[]string{
+				"1:6: cannot assign to f(a)",
+			},
+			"x",
+		},
+		{
+			"puts({1}); x",
+			[]string{
+				"1:8: expected next token to be :, got } instead",
+			},
+			"x",
+		},
+		{
+			"let h = {1 2}; x",
+			[]string{
+				"1:12: expected next token to be :, got INT instead",
+			},
+			"x",
+		},
+		{
+			"if (a > { puts(1) }",
+			[]string{
+				"1:19: expected next token to be :, got } instead",
+			},
+			"",
+		},
+		{
+			"if (x) { puts({1}); y } z",
+			[]string{
+				"1:17: expected next token to be :, got } instead",
+			},
+			"ifx yz",
+		},
+		{
+			"}; x",
+			[]string{
+				"1:1: no prefix parse function for } found",
+			},
+			"x",
+		},
+		{
+			"( ( <= ( % = len null",
+			[]string{
+				"1:5: no prefix parse function for <= found",
+			},
+			"",
+		},
+	}
+
+	for _, tt := range tests {
+		l := lexer.NewLexer(tt.input)
+		p, _ := NewParser(l)
+		program := p.ParseProgram()
+
+		errors := p.Errors()
+		if len(errors) != len(tt.expectedErrors) {
+			t.Errorf("input %q: wrong number of errors. want=%d, got=%d (%v)",
+				tt.input, len(tt.expectedErrors), len(errors), errors)
+			continue
+		}
+		for i, msg := range tt.expectedErrors {
+			if errors[i].Error() != msg {
+				t.Errorf("input %q: errors[%d] wrong. want=%q, got=%q",
+					tt.input, i, msg, errors[i].Error())
+			}
+		}
+
+		for i, stmt := range program.Statements {
+			if stmt == nil {
+				t.Errorf("input %q: program.Statements[%d] is nil", tt.input, i)
+			}
+		}
+		if program.String() != tt.expectedStatements {
+			t.Errorf("input %q: program wrong. want=%q, got=%q",
+				tt.input, tt.expectedStatements, program.String())
+		}
+	}
+}
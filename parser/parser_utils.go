@@ -11,26 +11,50 @@ import (
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // = += -= *= /=
+	LOGICALOR   // ||
+	LOGICALAND  // &&
 	EQUALS      // ==
-	LESSGREATER // > or <
+	LESSGREATER // > or < or <= or >=
+	BITOR       // |
+	BITXOR      // ^
+	BITAND      // &
+	SHIFT       // << or >>
 	SUM         // +
-	PRODUCT     // *
-	PREFIX      // -X or !X
+	PRODUCT     // * or / or %
+	PREFIX      // -X or !X or ~X
+	POWER       // ** binds tighter than prefix operators, -2 ** 2 == -(2 ** 2)
 	CALL        // myFunction(X)
 	INDEX
 )
 
 var precedences = map[token.TokenType]int{
-	token.EQ:       EQUALS,
-	token.NOT_EQ:   EQUALS,
-	token.LT:       LESSGREATER,
-	token.GT:       LESSGREATER,
-	token.PLUS:     SUM,
-	token.MINUS:    SUM,
-	token.SLASH:    PRODUCT,
-	token.ASTERISK: PRODUCT,
-	token.LPAREN:   CALL, // when we see '(' we need to give the highest priotity
-	token.LBRACKET: INDEX,
+	token.ASSIGN:          ASSIGN,
+	token.PLUS_ASSIGN:     ASSIGN,
+	token.MINUS_ASSIGN:    ASSIGN,
+	token.ASTERISK_ASSIGN: ASSIGN,
+	token.SLASH_ASSIGN:    ASSIGN,
+	token.OR:              LOGICALOR,
+	token.AND:             LOGICALAND,
+	token.EQ:              EQUALS,
+	token.NOT_EQ:          EQUALS,
+	token.LT:              LESSGREATER,
+	token.GT:              LESSGREATER,
+	token.LE:              LESSGREATER,
+	token.GE:              LESSGREATER,
+	token.PIPE:            BITOR,
+	token.CARET:           BITXOR,
+	token.AMPERSAND:       BITAND,
+	token.LSHIFT:          SHIFT,
+	token.RSHIFT:          SHIFT,
+	token.PLUS:            SUM,
+	token.MINUS:           SUM,
+	token.SLASH:           PRODUCT,
+	token.ASTERISK:        PRODUCT,
+	token.PERCENT:         PRODUCT,
+	token.POWER:           POWER,
+	token.LPAREN:          CALL, // when we see '(' we need to give the highest priotity
+	token.LBRACKET:        INDEX,
 }
 
 type (
@@ -46,15 +70,33 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParseFn) {
 	p.infixParseFns[tokenType] = fn
 }
 
+// errorAt records an error diagnostic spanning tok. While the parser is
+// recovering from a previous error the diagnostic is built but not recorded,
+// as it is most likely a follow-on of the first one.
+func (p *Parser) errorAt(tok token.Token, code ErrorCode, format string, a ...interface{}) *Diagnostic {
+	d := &Diagnostic{
+		Pos:      tok.Pos,
+		End:      tok.End,
+		Severity: SeverityError,
+		Code:     code,
+		Message:  fmt.Sprintf(format, a...),
+	}
+	if !p.recovering {
+		p.errors = append(p.errors, d)
+		p.recovering = true
+	}
+	return d
+}
+
 func (p *Parser) noPrefixParseFnError(t token.TokenType) {
-	msg := fmt.Sprintf("no prefix parse function for %s found", t)
-	p.errors = append(p.errors, msg)
+	p.errorAt(p.curToken, ErrNoPrefixParseFn, "no prefix parse function for %s found", t)
 }
 
 func (p *Parser) peekError(t token.TokenType) {
-	msg := fmt.Sprintf("expected next token to be %s, got %s instead",
-		t, p.peekToken.Type)
-	p.errors = append(p.errors, msg)
+	d := p.errorAt(p.peekToken, ErrUnexpectedToken,
+		"expected next token to be %s, got %s instead", t, p.peekToken.Type)
+	d.Expected = t
+	d.Got = p.peekToken.Type
 }
 
 func (p *Parser) expectPeek(t token.TokenType) bool {
@@ -68,8 +110,37 @@ func (p *Parser) expectPeek(t token.TokenType) bool {
 }
 
 func (p *Parser) nextToken() {
+	p.braceDepth = p.peekBraceDepth()
 	p.curToken = p.peekToken
 	p.peekToken = p.l.NextToken()
+
+	// Lexer errors are independent of whatever the parser is doing, so they
+	// are recorded even while recovering
+	for _, err := range p.l.Errors()[p.lexerErrors:] {
+		p.errors = append(p.errors, &Diagnostic{
+			Pos:      err.Pos,
+			End:      err.End,
+			Severity: SeverityError,
+			Code:     ErrLexical,
+			Message:  err.Message,
+		})
+		p.recovering = true
+	}
+	p.lexerErrors = len(p.l.Errors())
+}
+
+// peekBraceDepth is braceDepth for the peek token. A '}' with nothing to
+// close is left out.
+func (p *Parser) peekBraceDepth() int {
+	switch p.curToken.Type {
+	case token.LBRACE:
+		return p.braceDepth + 1
+	case token.RBRACE:
+		if p.braceDepth > 0 {
+			return p.braceDepth - 1
+		}
+	}
+	return p.braceDepth
 }
 
 func (p *Parser) peekPrecedence() int {
@@ -96,8 +167,21 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 
 	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
 	if err != nil {
-		msg := fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.errorAt(p.curToken, ErrInvalidInteger, "could not parse %q as integer", p.curToken.Literal)
+		return nil
+	}
+
+	literal.Value = value
+
+	return literal
+}
+
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	literal := &ast.FloatLiteral{Token: p.curToken}
+
+	value, err := strconv.ParseFloat(p.curToken.Literal, 64)
+	if err != nil {
+		p.errorAt(p.curToken, ErrInvalidFloat, "could not parse %q as float", p.curToken.Literal)
 		return nil
 	}
 
@@ -116,3 +200,7 @@ func (p *Parser) parseBoolean() ast.Expression {
 
 	return booleanExpression
 }
+
+func (p *Parser) parseNullLiteral() ast.Expression {
+	return &ast.NullLiteral{Token: p.curToken}
+}
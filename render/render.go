@@ -0,0 +1,229 @@
+// Package render prints parser diagnostics and runtime errors together with
+// the offending source line and a caret under the span they refer to:
+//
+//	error[E001]: expected next token to be ), got { instead
+//	 --> 1:10
+//	  |
+//	1 | add(1, 2 { 3 }
+//	  |          ^
+//	  = hint: expected ) here
+package render
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/iZarrios/monkey-lang/object"
+	"github.com/iZarrios/monkey-lang/parser"
+	"github.com/iZarrios/monkey-lang/token"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[1;31m"
+	ansiYellow = "\x1b[1;33m"
+	ansiBlue   = "\x1b[1;34m"
+	ansiCyan   = "\x1b[1;36m"
+)
+
+type Renderer struct {
+	Filename string // shown in front of positions, may be empty
+	Color    bool   // use ANSI escape sequences
+
+	lines []string
+}
+
+func NewRenderer(filename, source string, color bool) *Renderer {
+	lines := strings.Split(source, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return &Renderer{Filename: filename, Color: color, lines: lines}
+}
+
+// report is what both parser diagnostics and runtime errors boil down to
+type report struct {
+	severity parser.Severity
+	code     parser.ErrorCode
+	pos      token.Position
+	end      token.Position
+	message  string
+	hint     string
+	trace    []object.Frame
+}
+
+func (r *Renderer) ParserErrors(w io.Writer, errors parser.ErrorList) {
+	for _, d := range errors {
+		r.render(w, report{
+			severity: d.Severity,
+			code:     d.Code,
+			pos:      d.Pos,
+			end:      d.End,
+			message:  d.Message,
+			hint:     parserHint(d),
+		})
+	}
+}
+
+func (r *Renderer) RuntimeError(w io.Writer, err *object.Error) {
+	r.render(w, report{
+		severity: parser.SeverityError,
+		pos:      err.Pos,
+		message:  err.Message,
+		hint:     runtimeHint(err),
+		trace:    err.Trace,
+	})
+}
+
+func parserHint(d *parser.Diagnostic) string {
+	switch d.Code {
+	case parser.ErrUnexpectedToken:
+		return fmt.Sprintf("expected %s here", d.Expected)
+	case parser.ErrNoPrefixParseFn:
+		return "an expression can't start here"
+	case parser.ErrInvalidInteger:
+		return "integers must fit in 64 bits"
+	case parser.ErrInvalidAssign:
+		return "only names and index expressions can be assigned to"
+	case parser.ErrLexical:
+		if strings.Contains(d.Message, "escape") {
+			return `valid escapes are \n \t \r \\ \" \xNN and \u{NNNN}`
+		}
+	}
+	return ""
+}
+
+func runtimeHint(err *object.Error) string {
+	if strings.HasPrefix(err.Message, "identifier not found") {
+		return "declare it with `let` before using it"
+	}
+	if strings.HasPrefix(err.Message, "assignment to undeclared identifier") {
+		return "declare it with `let` before assigning to it"
+	}
+	return ""
+}
+
+func (r *Renderer) render(w io.Writer, rep report) {
+	color := ansiRed
+	if rep.severity == parser.SeverityWarning {
+		color = ansiYellow
+	}
+
+	header := rep.severity.String()
+	if rep.code != "" {
+		header += "[" + string(rep.code) + "]"
+	}
+	fmt.Fprintf(w, "%s: %s\n", r.paint(color, header), r.paint(ansiBold, rep.message))
+
+	if !rep.pos.IsValid() {
+		if rep.hint != "" {
+			fmt.Fprintf(w, "  = %s %s\n", r.paint(ansiCyan, "hint:"), rep.hint)
+		}
+		r.renderTrace(w, "  ", rep.trace)
+		return
+	}
+
+	lineNo := fmt.Sprintf("%d", rep.pos.Line)
+	gutter := strings.Repeat(" ", len(lineNo)+1)
+
+	fmt.Fprintf(w, "%s%s %s\n", gutter[1:], r.paint(ansiBlue, "-->"), r.location(rep.pos))
+
+	if rep.pos.Line <= len(r.lines) {
+		line := r.lines[rep.pos.Line-1]
+		fmt.Fprintf(w, "%s%s\n", gutter, r.paint(ansiBlue, "|"))
+		fmt.Fprintf(w, "%s %s %s\n", r.paint(ansiBlue, lineNo), r.paint(ansiBlue, "|"), line)
+		fmt.Fprintf(w, "%s%s %s%s\n", gutter, r.paint(ansiBlue, "|"),
+			padding(line, rep.pos.Column), r.paint(color, underline(rep.pos, rep.end)))
+	}
+
+	if rep.hint != "" {
+		fmt.Fprintf(w, "%s%s %s\n", gutter, r.paint(ansiBlue, "="),
+			r.paint(ansiCyan, "hint:")+" "+rep.hint)
+	}
+	r.renderTrace(w, gutter, rep.trace)
+}
+
+// a trace longer than this shows its first and last frames only
+const (
+	maxTraceHead = 10
+	maxTraceTail = 5
+)
+
+// renderTrace lists the calls an error propagated out of, innermost first.
+// Runs of the same call, as in a recursion, are shown once with a count:
+//
+//	= trace: divide (called at 3:5)
+//	         loop (called at 4:9) ×99
+//	         <anonymous> (called at 5:1)
+func (r *Renderer) renderTrace(w io.Writer, gutter string, trace []object.Frame) {
+	lines := []string{}
+	// where each line starts in trace
+	starts := []int{}
+	for i := 0; i < len(trace); {
+		n := 1
+		for i+n < len(trace) && trace[i+n] == trace[i] {
+			n++
+		}
+		line := fmt.Sprintf("%s (called at %s)", trace[i].Function, r.location(trace[i].Pos))
+		if n > 1 {
+			line += fmt.Sprintf(" ×%d", n)
+		}
+		lines = append(lines, line)
+		starts = append(starts, i)
+		i += n
+	}
+
+	if len(lines) > maxTraceHead+maxTraceTail+1 {
+		tailStart := len(lines) - maxTraceTail
+		omitted := starts[tailStart] - starts[maxTraceHead]
+		head := lines[:maxTraceHead:maxTraceHead]
+		lines = append(append(head, fmt.Sprintf("... %d more frames", omitted)), lines[tailStart:]...)
+	}
+
+	for i, line := range lines {
+		label := r.paint(ansiBlue, "=") + " " + r.paint(ansiCyan, "trace:")
+		if i > 0 {
+			label = strings.Repeat(" ", len("= trace:"))
+		}
+		fmt.Fprintf(w, "%s%s %s\n", gutter, label, line)
+	}
+}
+
+func (r *Renderer) location(pos token.Position) string {
+	if r.Filename != "" {
+		return r.Filename + ":" + pos.String()
+	}
+	return pos.String()
+}
+
+// padding returns the whitespace that lines up with column in line, tabs are
+// kept so the caret ends up in the same place as the character above it
+func padding(line string, column int) string {
+	var out strings.Builder
+	runes := []rune(line)
+	for i := 0; i < column-1; i++ {
+		if i < len(runes) && runes[i] == '\t' {
+			out.WriteRune('\t')
+		} else {
+			out.WriteRune(' ')
+		}
+	}
+	return out.String()
+}
+
+func underline(pos, end token.Position) string {
+	width := 1
+	if end.Line == pos.Line && end.Column > pos.Column {
+		width = end.Column - pos.Column
+	}
+	return strings.Repeat("^", width)
+}
+
+func (r *Renderer) paint(color, s string) string {
+	if !r.Color {
+		return s
+	}
+	return color + s + ansiReset
+}
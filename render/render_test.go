@@ -0,0 +1,151 @@
+package render
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/iZarrios/monkey-lang/lexer"
+	"github.com/iZarrios/monkey-lang/object"
+	"github.com/iZarrios/monkey-lang/parser"
+	"github.com/iZarrios/monkey-lang/token"
+)
+
+func TestParserErrors(t *testing.T) {
+	input := "let x = 1;\nadd(1, 2 { 3 }"
+
+	l := lexer.NewLexer(input)
+	p, _ := parser.NewParser(l)
+	p.ParseProgram()
+
+	var out bytes.Buffer
+	NewRenderer("test.mk", input, false).ParserErrors(&out, p.Errors())
+
+	expected := `error[E001]: expected next token to be ), got { instead
+ --> test.mk:2:10
+  |
+2 | add(1, 2 { 3 }
+  |          ^
+  = hint: expected ) here
+`
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
+
+func TestRuntimeError(t *testing.T) {
+	tests := []struct {
+		input    string
+		err      *object.Error
+		expected string
+	}{
+		{
+			"\tlet y = x;",
+			&object.Error{
+				Message: "identifier not found: x",
+				Pos:     token.Position{Offset: 9, Line: 1, Column: 10},
+			},
+			"error: identifier not found: x\n" +
+				" --> 1:10\n" +
+				"  |\n" +
+				"1 | \tlet y = x;\n" +
+				"  | \t        ^\n" +
+				"  = hint: declare it with `let` before using it\n",
+		},
+		{
+			"5 + true",
+			&object.Error{Message: "type mismatch: INTEGER + BOOLEAN"},
+			"error: type mismatch: INTEGER + BOOLEAN\n",
+		},
+		{
+			"let f = fn(x) { x / 0 };\nlet g = fn() { f(1) };\ng()",
+			&object.Error{
+				Message: "division by zero",
+				Pos:     token.Position{Offset: 16, Line: 1, Column: 17},
+				Trace: []object.Frame{
+					{Function: "f", Pos: token.Position{Offset: 40, Line: 2, Column: 16}},
+					{Function: "g", Pos: token.Position{Offset: 47, Line: 3, Column: 1}},
+				},
+			},
+			"error: division by zero\n" +
+				" --> 1:17\n" +
+				"  |\n" +
+				"1 | let f = fn(x) { x / 0 };\n" +
+				"  |                 ^\n" +
+				"  = trace: f (called at 2:16)\n" +
+				"           g (called at 3:1)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		NewRenderer("", tt.input, false).RuntimeError(&out, tt.err)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output.\nwant=\n%s\ngot=\n%s", tt.expected, out.String())
+		}
+	}
+}
+
+func TestLongTraces(t *testing.T) {
+	f := object.Frame{Function: "f", Pos: token.Position{Offset: 15, Line: 1, Column: 16}}
+	g := object.Frame{Function: "g", Pos: token.Position{Offset: 0, Line: 2, Column: 1}}
+
+	recursive := []object.Frame{}
+	for i := 0; i < 20000; i++ {
+		recursive = append(recursive, f)
+	}
+	recursive = append(recursive, g)
+
+	mutual := []object.Frame{}
+	for i := 0; i < 20; i++ {
+		mutual = append(mutual, f, g)
+	}
+
+	tests := []struct {
+		trace    []object.Frame
+		expected string
+	}{
+		{
+			recursive,
+			"error: boom\n" +
+				"  = trace: f (called at 1:16) ×20000\n" +
+				"           g (called at 2:1)\n",
+		},
+		{
+			mutual,
+			"error: boom\n" +
+				"  = trace: f (called at 1:16)\n" +
+				strings.Repeat("           g (called at 2:1)\n"+
+					"           f (called at 1:16)\n", 4) +
+				"           g (called at 2:1)\n" +
+				"           ... 25 more frames\n" +
+				strings.Repeat("           g (called at 2:1)\n"+
+					"           f (called at 1:16)\n", 2) +
+				"           g (called at 2:1)\n",
+		},
+	}
+
+	for _, tt := range tests {
+		err := &object.Error{Message: "boom", Trace: tt.trace}
+
+		var out bytes.Buffer
+		NewRenderer("", "", false).RuntimeError(&out, err)
+
+		if out.String() != tt.expected {
+			t.Errorf("wrong output.\nwant=\n%s\ngot=\n%s", tt.expected, out.String())
+		}
+	}
+}
+
+func TestColor(t *testing.T) {
+	err := &object.Error{Message: "boom"}
+
+	var out bytes.Buffer
+	NewRenderer("", "", true).RuntimeError(&out, err)
+
+	expected := ansiRed + "error" + ansiReset + ": " + ansiBold + "boom" + ansiReset + "\n"
+	if out.String() != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, out.String())
+	}
+}
@@ -4,11 +4,14 @@ import (
 	"bufio"
 	"fmt"
 	"io"
+	"os"
+	"strings"
 
 	"github.com/iZarrios/monkey-lang/evaluator"
 	"github.com/iZarrios/monkey-lang/lexer"
 	"github.com/iZarrios/monkey-lang/object"
 	"github.com/iZarrios/monkey-lang/parser"
+	"github.com/iZarrios/monkey-lang/render"
 )
 
 const (
@@ -17,9 +20,16 @@ const (
 
 func Start(in io.Reader, out io.Writer) {
 	scanner := bufio.NewScanner(in)
+	macroEnv := object.NewEnvironment()
 	env := object.NewEnvironment()
+	// macroexpand looks the macros up at run time
+	env.SetMacros(macroEnv)
 
-	for {
+	// Every line is lexed as the next line of history. Code defined on an
+	// earlier line can fail later, and its positions still point there.
+	var history strings.Builder
+
+	for lineNo := 1; ; lineNo++ {
 		fmt.Fprint(out, PROMPT)
 		scanned := scanner.Scan()
 		if !scanned {
@@ -27,18 +37,33 @@ func Start(in io.Reader, out io.Writer) {
 		}
 		line := scanner.Text()
 
-		l := lexer.NewLexer(line)
+		l := lexer.NewLexerAt(line, lineNo, history.Len())
 		p, _ := parser.NewParser(l)
 
 		program := p.ParseProgram()
 
+		history.WriteString(line)
+		history.WriteString("\n")
+		r := render.NewRenderer("", history.String(), isTerminal(out))
+
 		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+			printParserErrors(out, r, p.Errors())
 			continue
 		}
 
 		// We have parsed the whole program now and we have found no errors in it
-		evaluated := evaluator.Eval(program, env)
+		evaluator.DefineMacros(program, macroEnv)
+		expanded, err := evaluator.ExpandMacros(program, macroEnv)
+		if err != nil {
+			r.RuntimeError(out, err)
+			continue
+		}
+
+		evaluated := evaluator.Eval(expanded, env)
+		if err, ok := evaluated.(*object.Error); ok {
+			r.RuntimeError(out, err)
+			continue
+		}
 		if evaluated != nil {
 			io.WriteString(out, evaluated.Inspect())
 			io.WriteString(out, "\n")
@@ -46,9 +71,19 @@ func Start(in io.Reader, out io.Writer) {
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	io.WriteString(out, " parser errors:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+func printParserErrors(out io.Writer, r *render.Renderer, errors parser.ErrorList) {
+	r.ParserErrors(out, errors)
+}
+
+// isTerminal reports whether out is a terminal, only then do we emit colors
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
 	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
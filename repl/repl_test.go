@@ -0,0 +1,27 @@
+package repl
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestStartRendersErrorsAgainstTheirLine(t *testing.T) {
+	input := "let f = fn(x) { let y = 2; x / 0 };\n" +
+		"let z = 1;\n" +
+		"f(1)\n"
+
+	var out bytes.Buffer
+	Start(strings.NewReader(input), &out)
+
+	expected := ">> >> >> error: division by zero\n" +
+		" --> 1:30\n" +
+		"  |\n" +
+		"1 | let f = fn(x) { let y = 2; x / 0 };\n" +
+		"  |                              ^\n" +
+		"  = trace: f (called at 3:1)\n" +
+		">> "
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}
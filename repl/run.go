@@ -0,0 +1,87 @@
+package repl
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/iZarrios/monkey-lang/ast"
+	"github.com/iZarrios/monkey-lang/evaluator"
+	"github.com/iZarrios/monkey-lang/lexer"
+	"github.com/iZarrios/monkey-lang/object"
+	"github.com/iZarrios/monkey-lang/parser"
+	"github.com/iZarrios/monkey-lang/render"
+)
+
+// ErrRunFailed is returned by RunFile once the reason has been reported
+var ErrRunFailed = errors.New("run failed")
+
+// RunFile parses and evaluates the program in filename. Parser and runtime
+// errors are rendered to errOut, a non-nil error means the program did not run
+// to completion.
+func RunFile(filename string, errOut io.Writer) error {
+	expanded, macroEnv, r, err := expandFile(filename, errOut)
+	if err != nil {
+		return err
+	}
+
+	env := object.NewEnvironment()
+	// macroexpand looks the macros up at run time
+	env.SetMacros(macroEnv)
+	evaluated := evaluator.Eval(expanded, env)
+	if err, ok := evaluated.(*object.Error); ok {
+		r.RuntimeError(errOut, err)
+		return ErrRunFailed
+	}
+
+	return nil
+}
+
+// ExpandFile prints the program in filename to out as source code with its
+// macros expanded. Errors are rendered to errOut like in RunFile. The output
+// is for reading only: names a macro renamed for hygiene, like `tmp#3`, can't
+// be written in source code, so it won't always parse again.
+func ExpandFile(filename string, out, errOut io.Writer) error {
+	expanded, _, _, err := expandFile(filename, errOut)
+	if err != nil {
+		return err
+	}
+
+	for _, stmt := range expanded.Statements {
+		fmt.Fprintln(out, ast.Format(stmt))
+	}
+	return nil
+}
+
+// expandFile parses filename and expands its macros. It returns the renderer
+// for the file along with the macros it defines.
+func expandFile(filename string, errOut io.Writer) (*ast.Program, *object.Environment, *render.Renderer, error) {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		fmt.Fprintf(errOut, "error: %s\n", err)
+		return nil, nil, nil, ErrRunFailed
+	}
+
+	l := lexer.NewLexer(string(source))
+	p, _ := parser.NewParser(l)
+
+	program := p.ParseProgram()
+
+	r := render.NewRenderer(filename, string(source), isTerminal(errOut))
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(errOut, r, p.Errors())
+		return nil, nil, nil, ErrRunFailed
+	}
+
+	macroEnv := object.NewEnvironment()
+	evaluator.DefineMacros(program, macroEnv)
+	expanded, expandErr := evaluator.ExpandMacros(program, macroEnv)
+	if expandErr != nil {
+		r.RuntimeError(errOut, expandErr)
+		return nil, nil, nil, ErrRunFailed
+	}
+
+	return expanded.(*ast.Program), macroEnv, r, nil
+}
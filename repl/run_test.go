@@ -0,0 +1,37 @@
+package repl
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExpandFile(t *testing.T) {
+	input := `let unless = macro(cond, cons, alt) {
+	quote(if (!(unquote(cond))) { unquote(cons) } else { unquote(alt) })
+};
+let greeting = "hello, world";
+unless(10 > 5, puts("not greater"), puts(greeting + "\n"));
+`
+	expected := `let greeting = "hello, world";
+if (!(10 > 5)) {
+	puts("not greater");
+} else {
+	puts(greeting + "\n");
+}
+`
+
+	filename := filepath.Join(t.TempDir(), "unless.monkey")
+	if err := os.WriteFile(filename, []byte(input), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out, errOut bytes.Buffer
+	if err := ExpandFile(filename, &out, &errOut); err != nil {
+		t.Fatalf("ExpandFile returned error: %s\n%s", err, errOut.String())
+	}
+	if out.String() != expected {
+		t.Errorf("wrong output.\nwant=\n%s\ngot=\n%s", expected, out.String())
+	}
+}